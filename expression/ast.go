@@ -0,0 +1,728 @@
+package expression
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Node is a node in the abstract syntax tree of an expression.
+// It is one of *NumberNode, *VariableNode, *UnaryNode, *PostfixNode, *BinaryNode, *ConditionalNode, *AssignNode or *CallNode.
+// Every node has the Span of the input it was parsed from, which is empty for nodes that weren't parsed.
+type Node interface {
+	node()
+	span() Span
+}
+
+// Span is the part of the input between the byte offsets Start and End.
+type Span struct {
+	Start int
+	End   int
+}
+
+// NumberNode is a number literal.
+type NumberNode struct {
+	Value float64
+	Span  Span
+}
+
+// VariableNode is a reference to a variable or global.
+type VariableNode struct {
+	Name string
+	Span Span
+}
+
+// UnaryNode is an operator applied to a single operand, eg. the negation in -x or the logical not in !x.
+type UnaryNode struct {
+	Operator string
+	Operand  Node
+	Span     Span
+}
+
+// PostfixNode is an operator written after its single operand, eg. the factorial in n!.
+type PostfixNode struct {
+	Operator string
+	Operand  Node
+	Span     Span
+}
+
+// BinaryNode is an operator applied to two operands, eg. x + y.
+// The remainder of a % b has the sign of b, and a // b rounds the quotient down, so a = b*(a // b) + a % b.
+// Comparison and logical operators give 1 for true and 0 for false.
+type BinaryNode struct {
+	Operator string
+	Left     Node
+	Right    Node
+	Span     Span
+}
+
+// ConditionalNode is Then if Condition is true, that is not 0, and Else otherwise, written if(Condition, Then, Else).
+// Only the branch that is chosen is evaluated.
+type ConditionalNode struct {
+	Condition Node
+	Then      Node
+	Else      Node
+	Span      Span
+}
+
+// AssignNode gives Name the value of Value while evaluating Body, written name = value; body.
+// A name assigned this way hides any variable or global of the same name inside Body.
+// The Span of an AssignNode is the part of the input that assigns the name, eg. r = 2.
+type AssignNode struct {
+	Name  string
+	Value Node
+	Body  Node
+	Span  Span
+}
+
+// CallNode is a call of a function with any number of arguments.
+type CallNode struct {
+	Name string
+	Args []Node
+	Span Span
+}
+
+func (*NumberNode) node()      {}
+func (*VariableNode) node()    {}
+func (*UnaryNode) node()       {}
+func (*PostfixNode) node()     {}
+func (*BinaryNode) node()      {}
+func (*ConditionalNode) node() {}
+func (*AssignNode) node()      {}
+func (*CallNode) node()        {}
+
+func (n *NumberNode) span() Span      { return n.Span }
+func (n *VariableNode) span() Span    { return n.Span }
+func (n *UnaryNode) span() Span       { return n.Span }
+func (n *PostfixNode) span() Span     { return n.Span }
+func (n *BinaryNode) span() Span      { return n.Span }
+func (n *ConditionalNode) span() Span { return n.Span }
+func (n *AssignNode) span() Span      { return n.Span }
+func (n *CallNode) span() Span        { return n.Span }
+
+// A Visitor's Visit method is invoked for each node encountered by Walk.
+// If the result visitor w is not nil, Walk visits each of the children of node with the visitor w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the tree in depth-first order.
+// It starts by calling v.Visit(node); node must not be nil.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *UnaryNode:
+		Walk(v, n.Operand)
+	case *PostfixNode:
+		Walk(v, n.Operand)
+	case *BinaryNode:
+		Walk(v, n.Left)
+		Walk(v, n.Right)
+	case *ConditionalNode:
+		Walk(v, n.Condition)
+		Walk(v, n.Then)
+		Walk(v, n.Else)
+	case *AssignNode:
+		Walk(v, n.Value)
+		Walk(v, n.Body)
+	case *CallNode:
+		for _, arg := range n.Args {
+			Walk(v, arg)
+		}
+	}
+
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses the tree in depth-first order, calling f(node) for each node.
+// If f returns true, Inspect continues with the children of node, followed by a call of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// Rewrite creates a copy of the tree with f applied to every node, children first.
+// The node passed to f already has its children rewritten, and f returns the node to take its place.
+// The original tree is not modified.
+func Rewrite(node Node, f func(Node) Node) Node {
+	switch n := node.(type) {
+	case *NumberNode:
+		return f(&NumberNode{Value: n.Value, Span: n.Span})
+	case *VariableNode:
+		return f(&VariableNode{Name: n.Name, Span: n.Span})
+	case *UnaryNode:
+		return f(&UnaryNode{
+			Operator: n.Operator,
+			Operand:  Rewrite(n.Operand, f),
+			Span:     n.Span,
+		})
+	case *PostfixNode:
+		return f(&PostfixNode{
+			Operator: n.Operator,
+			Operand:  Rewrite(n.Operand, f),
+			Span:     n.Span,
+		})
+	case *BinaryNode:
+		return f(&BinaryNode{
+			Operator: n.Operator,
+			Left:     Rewrite(n.Left, f),
+			Right:    Rewrite(n.Right, f),
+			Span:     n.Span,
+		})
+	case *ConditionalNode:
+		return f(&ConditionalNode{
+			Condition: Rewrite(n.Condition, f),
+			Then:      Rewrite(n.Then, f),
+			Else:      Rewrite(n.Else, f),
+			Span:      n.Span,
+		})
+	case *AssignNode:
+		return f(&AssignNode{
+			Name:  n.Name,
+			Value: Rewrite(n.Value, f),
+			Body:  Rewrite(n.Body, f),
+			Span:  n.Span,
+		})
+	case *CallNode:
+		args := make([]Node, len(n.Args))
+		for i, arg := range n.Args {
+			args[i] = Rewrite(arg, f)
+		}
+		return f(&CallNode{
+			Name: n.Name,
+			Args: args,
+			Span: n.Span,
+		})
+	}
+	panic("The node is not a valid node type, this should never happen")
+}
+
+// rewriteFree creates a copy of the tree with f applied to every variable that isn't assigned before it is used.
+func rewriteFree(node Node, f func(*VariableNode) Node) Node {
+	return rewriteFreeIn(node, map[string]bool{}, f)
+}
+
+func rewriteFreeIn(node Node, assigned map[string]bool, f func(*VariableNode) Node) Node {
+	switch n := node.(type) {
+	case *NumberNode:
+		return &NumberNode{Value: n.Value, Span: n.Span}
+	case *VariableNode:
+		if assigned[n.Name] {
+			return &VariableNode{Name: n.Name, Span: n.Span}
+		}
+		return f(&VariableNode{Name: n.Name, Span: n.Span})
+	case *UnaryNode:
+		return &UnaryNode{
+			Operator: n.Operator,
+			Operand:  rewriteFreeIn(n.Operand, assigned, f),
+			Span:     n.Span,
+		}
+	case *PostfixNode:
+		return &PostfixNode{
+			Operator: n.Operator,
+			Operand:  rewriteFreeIn(n.Operand, assigned, f),
+			Span:     n.Span,
+		}
+	case *BinaryNode:
+		return &BinaryNode{
+			Operator: n.Operator,
+			Left:     rewriteFreeIn(n.Left, assigned, f),
+			Right:    rewriteFreeIn(n.Right, assigned, f),
+			Span:     n.Span,
+		}
+	case *ConditionalNode:
+		return &ConditionalNode{
+			Condition: rewriteFreeIn(n.Condition, assigned, f),
+			Then:      rewriteFreeIn(n.Then, assigned, f),
+			Else:      rewriteFreeIn(n.Else, assigned, f),
+			Span:      n.Span,
+		}
+	case *AssignNode:
+		inner := map[string]bool{n.Name: true}
+		for name := range assigned {
+			inner[name] = true
+		}
+		return &AssignNode{
+			Name:  n.Name,
+			Value: rewriteFreeIn(n.Value, assigned, f),
+			Body:  rewriteFreeIn(n.Body, inner, f),
+			Span:  n.Span,
+		}
+	case *CallNode:
+		args := make([]Node, len(n.Args))
+		for i, arg := range n.Args {
+			args[i] = rewriteFreeIn(arg, assigned, f)
+		}
+		return &CallNode{
+			Name: n.Name,
+			Args: args,
+			Span: n.Span,
+		}
+	}
+	panic("The node is not a valid node type, this should never happen")
+}
+
+// freeNames finds the names of the variables in the tree that aren't assigned before they are used.
+func freeNames(node Node) map[string]struct{} {
+	names := map[string]struct{}{}
+	Inspect(node, func(n Node) bool {
+		switch n := n.(type) {
+		case *VariableNode:
+			names[n.Name] = struct{}{}
+		case *AssignNode:
+			for name := range freeNames(n.Value) {
+				names[name] = struct{}{}
+			}
+			for name := range freeNames(n.Body) {
+				if name != n.Name {
+					names[name] = struct{}{}
+				}
+			}
+			return false
+		}
+		return true
+	})
+	return names
+}
+
+// usedNames finds every name in the tree, both the variables and the names assigned.
+func usedNames(node Node) map[string]bool {
+	names := map[string]bool{}
+	Inspect(node, func(n Node) bool {
+		switch n := n.(type) {
+		case *VariableNode:
+			names[n.Name] = true
+		case *AssignNode:
+			names[n.Name] = true
+		}
+		return true
+	})
+	return names
+}
+
+// freshName returns the name if it isn't taken, otherwise the name followed by the first number that makes it a name
+// that isn't taken, eg. t1 for t or t2 for t1. The name returned is then taken.
+func freshName(name string, taken map[string]bool) string {
+	base := strings.TrimRightFunc(name, unicode.IsDigit)
+	for i := 1; taken[name]; i++ {
+		name = base + strconv.Itoa(i)
+	}
+	taken[name] = true
+	return name
+}
+
+// hoistAssignments moves the names assigned inside other nodes, eg. by inlining a defined function, to the start of the
+// statement they are in, so the tree can be printed as a program that parses back.
+// A name moved is renamed by adding a number if it is assigned more than once or used outside its assignment, eg. t1.
+// The values moved are calculated before the rest of the statement, even if the node they were in wouldn't be, eg. a branch of if.
+func hoistAssignments(root Node) Node {
+
+	assigned := map[string]int{}
+	Inspect(root, func(n Node) bool {
+		if a, ok := n.(*AssignNode); ok {
+			assigned[a.Name]++
+		}
+		return true
+	})
+	free := freeNames(root)
+	keep := func(name string) bool {
+		_, isFree := free[name]
+		return assigned[name] == 1 && !isFree
+	}
+
+	return hoistStatement(root, keep, usedNames(root))
+}
+
+// hoistStatement moves the assignments inside the statements of the program to the start of each statement.
+func hoistStatement(node Node, keep func(string) bool, taken map[string]bool) Node {
+
+	var moved []*AssignNode
+	if a, ok := node.(*AssignNode); ok {
+		node = &AssignNode{
+			Name:  a.Name,
+			Value: hoist(a.Value, keep, taken, &moved),
+			Body:  hoistStatement(a.Body, keep, taken),
+			Span:  a.Span,
+		}
+	} else {
+		node = hoist(node, keep, taken, &moved)
+	}
+
+	for i := len(moved) - 1; i >= 0; i-- {
+		moved[i].Body = node
+		node = moved[i]
+	}
+	return node
+}
+
+// hoist creates a copy of the tree without its assignments, adding them to moved in the order they are calculated.
+func hoist(node Node, keep func(string) bool, taken map[string]bool, moved *[]*AssignNode) Node {
+	switch n := node.(type) {
+	case *AssignNode:
+		value := hoist(n.Value, keep, taken, moved)
+		name, body := n.Name, n.Body
+		if !keep(name) {
+			name = freshName(name, taken)
+			body = rewriteFree(body, func(v *VariableNode) Node {
+				if v.Name == n.Name {
+					v.Name = name
+				}
+				return v
+			})
+		}
+		*moved = append(*moved, &AssignNode{Name: name, Value: value, Span: n.Span})
+		return hoist(body, keep, taken, moved)
+	case *UnaryNode:
+		return &UnaryNode{
+			Operator: n.Operator,
+			Operand:  hoist(n.Operand, keep, taken, moved),
+			Span:     n.Span,
+		}
+	case *PostfixNode:
+		return &PostfixNode{
+			Operator: n.Operator,
+			Operand:  hoist(n.Operand, keep, taken, moved),
+			Span:     n.Span,
+		}
+	case *BinaryNode:
+		return &BinaryNode{
+			Operator: n.Operator,
+			Left:     hoist(n.Left, keep, taken, moved),
+			Right:    hoist(n.Right, keep, taken, moved),
+			Span:     n.Span,
+		}
+	case *ConditionalNode:
+		return &ConditionalNode{
+			Condition: hoist(n.Condition, keep, taken, moved),
+			Then:      hoist(n.Then, keep, taken, moved),
+			Else:      hoist(n.Else, keep, taken, moved),
+			Span:      n.Span,
+		}
+	case *CallNode:
+		args := make([]Node, len(n.Args))
+		for i, arg := range n.Args {
+			args[i] = hoist(arg, keep, taken, moved)
+		}
+		return &CallNode{
+			Name: n.Name,
+			Args: args,
+			Span: n.Span,
+		}
+	}
+	return node
+}
+
+// parseProgram parses statements separated by semicolons into a syntax tree and the functions defined by the program.
+// Every statement but the last assigns a name or defines a function, and the last gives the value of the program.
+// When recovering from errors, statements that can't be used are left out.
+func parseProgram(tokens []token, errs *errorList) (Node, map[string]*Function, error) {
+
+	var statements [][]token
+	// the semicolons ending each statement
+	var ends []token
+	start := 0
+	for i, t := range tokens {
+		if isSeparatorToken(t, ';') {
+			statements = append(statements, tokens[start:i])
+			ends = append(ends, t)
+			start = i + 1
+		}
+	}
+	statements = append(statements, tokens[start:])
+
+	var names []token
+	var values []Node
+	var body Node
+	functions := map[string]*Function{}
+
+	for i, statement := range statements {
+		if len(statement) == 0 {
+			// an empty statement is shown by the semicolon before or after it
+			err := SyntaxError{
+				Description: "Empty statement",
+			}
+			if len(ends) != 0 {
+				end := ends[len(ends)-1]
+				if i < len(ends) {
+					end = ends[i]
+				}
+				err.Position, err.End = end.start, end.end
+			}
+			if err := errs.add(err); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		span := Span{Start: statement[0].start, End: statement[len(statement)-1].end}
+		last := i == len(statements)-1
+
+		if isDefinition(statement) {
+			if last {
+				if err := errs.add(SyntaxError{
+					Description: "The last statement must be an expression rather than a definition",
+					Position:    span.Start,
+					End:         span.End,
+				}); err != nil {
+					return nil, nil, err
+				}
+			}
+			f, err := parseDefinition(statement, functions)
+			if err != nil {
+				if err := errs.add(withSpan(err, span).(SyntaxError)); err != nil {
+					return nil, nil, err
+				}
+				continue
+			}
+			functions[f.Name] = f
+			continue
+		}
+
+		assignment := len(statement) >= 2 && statement[1].kind == tokenOperator && statement[1].value.(string) == "="
+		if assignment && statement[0].kind != tokenVariable {
+			if err := errs.add(SyntaxError{
+				Description: "Can only assign to a name",
+				Position:    statement[0].start,
+				End:         statement[0].end,
+			}); err != nil {
+				return nil, nil, err
+			}
+			// use the value alone
+			assignment = false
+			statement = statement[2:]
+		}
+		if assignment && last {
+			// the value of the program is then the name assigned
+			if err := errs.add(SyntaxError{
+				Description: "The last statement must be an expression rather than an assignment",
+				Position:    span.Start,
+				End:         span.End,
+			}); err != nil {
+				return nil, nil, err
+			}
+		}
+		if !assignment && !last {
+			if err := errs.add(SyntaxError{
+				Description: "Every statement but the last must assign a name or define a function",
+				Position:    span.Start,
+				End:         span.End,
+			}); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		var name token
+		if assignment {
+			name, statement = statement[0], statement[2:]
+		}
+
+		value, err := parseStatement(statement)
+		if err != nil {
+			if err := errs.add(withSpan(err, span).(SyntaxError)); err != nil {
+				return nil, nil, err
+			}
+			value = &NumberNode{Value: math.NaN(), Span: span}
+		}
+
+		if assignment {
+			names = append(names, name)
+			values = append(values, value)
+		} else {
+			body = value
+		}
+	}
+
+	if body == nil && len(names) != 0 {
+		last := names[len(names)-1]
+		body = &VariableNode{Name: last.value.(string), Span: last.span()}
+	} else if body == nil {
+		body = &NumberNode{Value: math.NaN()}
+	}
+
+	root := body
+	for i := len(names) - 1; i >= 0; i-- {
+		root = &AssignNode{
+			Name:  names[i].value.(string),
+			Value: values[i],
+			Body:  root,
+			Span:  Span{Start: names[i].start, End: values[i].span().End},
+		}
+	}
+
+	// calls are checked once every function is defined, as a function can be called before its definition
+	var err error
+	for _, name := range sortedNames(functions) {
+		f := functions[name]
+		if f.Body, err = checkArity(f.Body, functions, errs); err != nil {
+			return nil, nil, err
+		}
+	}
+	if root, err = checkArity(root, functions, errs); err != nil {
+		return nil, nil, err
+	}
+
+	return root, functions, nil
+}
+
+// isDefinition checks if the statement defines a function, name(parameters) = body.
+func isDefinition(statement []token) bool {
+	if len(statement) < 2 || statement[0].kind != tokenFunction || isPrefix(statement[0]) || !isSeparatorToken(statement[1], '(') {
+		return false
+	}
+	for i, t := range statement {
+		if isSeparatorToken(t, ')') {
+			return i+1 < len(statement) && statement[i+1].kind == tokenOperator && statement[i+1].value.(string) == "="
+		}
+	}
+	return false
+}
+
+// parseStatement parses the tokens of a statement other than the name it assigns.
+func parseStatement(statement []token) (Node, error) {
+	shunted, err := shuntingYard(statement)
+	if err != nil {
+		return nil, err
+	}
+	return buildTree(shunted)
+}
+
+// buildTree converts the output of the shunting yard into a syntax tree.
+func buildTree(shunted []token) (Node, error) {
+
+	var stack []Node
+
+	for _, t := range shunted {
+		switch t.kind {
+		case tokenNumber:
+			stack = append(stack, &NumberNode{Value: t.value.(float64), Span: t.span()})
+
+		case tokenVariable:
+			stack = append(stack, &VariableNode{Name: t.value.(string), Span: t.span()})
+
+		case tokenOperator:
+			if len(stack) < 2 {
+				return nil, SyntaxError{
+					Description: "Not enough parameters for operator",
+					Position:    t.start,
+					End:         t.end,
+				}
+			}
+
+			var left, right Node
+			right, stack = stack[len(stack)-1], stack[:len(stack)-1]
+			left, stack = stack[len(stack)-1], stack[:len(stack)-1]
+
+			stack = append(stack, &BinaryNode{
+				Operator: t.value.(string),
+				Left:     left,
+				Right:    right,
+				Span:     Span{Start: left.span().Start, End: right.span().End},
+			})
+
+		case tokenPostfix:
+			if len(stack) < 1 {
+				return nil, SyntaxError{
+					Description: "Not enough parameters for operator",
+					Position:    t.start,
+					End:         t.end,
+				}
+			}
+
+			operand := stack[len(stack)-1]
+			stack[len(stack)-1] = &PostfixNode{
+				Operator: t.value.(string),
+				Operand:  operand,
+				Span:     Span{Start: operand.span().Start, End: t.end},
+			}
+
+		case tokenFunction:
+			if len(stack) < t.arity {
+				return nil, SyntaxError{
+					Description: "Not enough parameters for function",
+					Position:    t.start,
+					End:         t.end,
+				}
+			}
+
+			args := append([]Node{}, stack[len(stack)-t.arity:]...)
+			stack = stack[:len(stack)-t.arity]
+
+			// the span of a function ends at its closing bracket, the span of a prefix operator at the end of its operand
+			span := t.span()
+			if len(args) != 0 && args[len(args)-1].span().End > span.End {
+				span.End = args[len(args)-1].span().End
+			}
+
+			if name, ok := t.value.(reservedFunction); ok {
+				switch name {
+				case negateFunction:
+					stack = append(stack, &UnaryNode{
+						Operator: "-",
+						Operand:  args[0],
+						Span:     span,
+					})
+				case notFunction:
+					stack = append(stack, &UnaryNode{
+						Operator: "!",
+						Operand:  args[0],
+						Span:     span,
+					})
+				case conditionalFunction:
+					if len(args) != 3 {
+						return nil, SyntaxError{
+							Description: fmt.Sprintf("if takes 3 parameters but got %d", len(args)),
+							Position:    span.Start,
+							End:         span.End,
+						}
+					}
+					stack = append(stack, &ConditionalNode{
+						Condition: args[0],
+						Then:      args[1],
+						Else:      args[2],
+						Span:      span,
+					})
+				default:
+					panic("The internal function is somehow not a valid internal function, this should never happen")
+				}
+				continue
+			}
+
+			stack = append(stack, &CallNode{
+				Name: t.value.(string),
+				Args: args,
+				Span: span,
+			})
+		}
+	}
+
+	if len(stack) == 0 {
+		return nil, SyntaxError{
+			Description: "There is no value left on the stack, check expression",
+		}
+	}
+
+	if len(stack) > 1 {
+		// the operator is missing before the second value
+		return nil, SyntaxError{
+			Description: "Too many values, missing operator",
+			Position:    stack[1].span().Start,
+			End:         stack[1].span().End,
+		}
+	}
+
+	return stack[0], nil
+}
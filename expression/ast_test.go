@@ -0,0 +1,149 @@
+package expression
+
+import (
+	"testing"
+)
+
+func TestSyntaxTree(t *testing.T) {
+	expr, e := GetExpression("-a + max(b, 2) * c ^ 2")
+	if e != nil {
+		t.Fatalf("Got unexpected error %s", e)
+	}
+
+	sum, ok := expr.Root().(*BinaryNode)
+	if !ok || sum.Operator != "+" {
+		t.Fatalf("Expected the root to be an addition but got %#v", expr.Root())
+	}
+
+	negation, ok := sum.Left.(*UnaryNode)
+	if !ok || negation.Operator != "-" {
+		t.Fatalf("Expected a negation but got %#v", sum.Left)
+	}
+	if v, ok := negation.Operand.(*VariableNode); !ok || v.Name != "a" {
+		t.Errorf("Expected the variable a but got %#v", negation.Operand)
+	}
+
+	product, ok := sum.Right.(*BinaryNode)
+	if !ok || product.Operator != "*" {
+		t.Fatalf("Expected a multiplication but got %#v", sum.Right)
+	}
+
+	call, ok := product.Left.(*CallNode)
+	if !ok || call.Name != "max" || len(call.Args) != 2 {
+		t.Fatalf("Expected a call of max with 2 arguments but got %#v", product.Left)
+	}
+	if n, ok := call.Args[1].(*NumberNode); !ok || n.Value != 2 {
+		t.Errorf("Expected the number 2 but got %#v", call.Args[1])
+	}
+
+	power, ok := product.Right.(*BinaryNode)
+	if !ok || power.Operator != "^" {
+		t.Fatalf("Expected a power but got %#v", product.Right)
+	}
+}
+
+func TestSyntaxTreeTooManyValues(t *testing.T) {
+	_, err := GetExpression("f(1)(2)")
+	if err == nil {
+		t.Fatal("Expected an error but got nothing.")
+	}
+}
+
+type countingVisitor map[string]int
+
+func (v countingVisitor) Visit(node Node) Visitor {
+	switch node.(type) {
+	case *NumberNode:
+		v["number"]++
+	case *VariableNode:
+		v["variable"]++
+	case *UnaryNode:
+		v["unary"]++
+	case *BinaryNode:
+		v["binary"]++
+	case *CallNode:
+		v["call"]++
+	}
+	return v
+}
+
+func TestWalk(t *testing.T) {
+	expr, e := GetExpression("-a + max(b, 2) * c ^ 2")
+	if e != nil {
+		t.Fatalf("Got unexpected error %s", e)
+	}
+
+	counts := countingVisitor{}
+	Walk(counts, expr.Root())
+
+	expected := map[string]int{
+		"number":   2,
+		"variable": 3,
+		"unary":    1,
+		"binary":   3,
+		"call":     1,
+	}
+
+	for kind, count := range expected {
+		if counts[kind] != count {
+			t.Errorf("Expected %d %s nodes but got %d", count, kind, counts[kind])
+		}
+	}
+}
+
+func TestInspectSkipsChildren(t *testing.T) {
+	expr, e := GetExpression("f(a) + b")
+	if e != nil {
+		t.Fatalf("Got unexpected error %s", e)
+	}
+
+	var names []string
+	Inspect(expr.Root(), func(node Node) bool {
+		if v, ok := node.(*VariableNode); ok {
+			names = append(names, v.Name)
+		}
+		_, call := node.(*CallNode)
+		return !call
+	})
+
+	if len(names) != 1 || names[0] != "b" {
+		t.Fatalf("Expected to only see the variable b but got %v", names)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	expr, e := GetExpression("x * y + x")
+	if e != nil {
+		t.Fatalf("Got unexpected error %s", e)
+	}
+
+	root := Rewrite(expr.Root(), func(node Node) Node {
+		if v, ok := node.(*VariableNode); ok && v.Name == "x" {
+			return &BinaryNode{
+				Operator: "+",
+				Left:     &VariableNode{Name: "z"},
+				Right:    &NumberNode{Value: 1},
+			}
+		}
+		return node
+	})
+
+	rewritten := NewExpression(root)
+	rewritten.SetVariables(map[string]float64{
+		"y": 3,
+		"z": 1,
+	})
+
+	result, err := rewritten.Eval()
+	if err != nil {
+		t.Fatalf("Unexpected Error\n%s", err)
+	}
+
+	if result != 8 {
+		t.Fatalf("Unexpected answer, expected %f but got %f", 8.0, result)
+	}
+
+	if _, ok := expr.VariableNames()["x"]; !ok {
+		t.Fatal("Expected the original expression to be unchanged")
+	}
+}
@@ -1,6 +1,9 @@
 package expression
 
-import "testing"
+import (
+	"math"
+	"testing"
+)
 
 func BenchmarkExpression(b *testing.B) {
 
@@ -15,4 +18,101 @@ func BenchmarkExpression(b *testing.B) {
 			b.Fatalf("Expected %f but got %f", expected, r)
 		}
 	}
-}
\ No newline at end of file
+}
+
+func BenchmarkCompiledExpression(b *testing.B) {
+
+	expresionString := "2 * 10 + 20 * (4 + 5) * 100/20 + 20/40"
+	expected := 920.5
+
+	expression, _ := GetExpression(expresionString)
+	compiled, err := expression.Compile()
+	if err != nil {
+		b.Fatalf("Compile failed, %s", err)
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r, _ := compiled.Eval(nil)
+		if r != expected {
+			b.Fatalf("Expected %f but got %f", expected, r)
+		}
+	}
+}
+
+func benchmarkModel(b *testing.B) *Expression {
+	expression, err := GetExpression("A*exp(-k*x)*cos(w*x + phi) + max(B, C, 0)")
+	if err != nil {
+		b.Fatalf("Problem setting up expression, %s", err)
+	}
+
+	expression.SetFunctions(map[string]func(float64) float64{
+		"exp": math.Exp,
+		"cos": math.Cos,
+	})
+	expression.SetVariadicFunctions(map[string]VariadicFunction{
+		"max": func(args ...float64) (float64, error) {
+			m := math.Inf(-1)
+			for _, arg := range args {
+				m = math.Max(m, arg)
+			}
+			return m, nil
+		},
+	})
+	expression.SetVariables(map[string]float64{
+		"A":   2,
+		"k":   0.5,
+		"w":   3,
+		"phi": 0.1,
+		"B":   1,
+		"C":   -1,
+		"x":   1.5,
+	})
+
+	return expression
+}
+
+func BenchmarkModel(b *testing.B) {
+
+	expression := benchmarkModel(b)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := expression.Eval(); err != nil {
+			b.Fatalf("Eval failed, %s", err)
+		}
+	}
+}
+
+func BenchmarkCompiledModel(b *testing.B) {
+
+	expression := benchmarkModel(b)
+	compiled, err := expression.Compile()
+	if err != nil {
+		b.Fatalf("Compile failed, %s", err)
+	}
+	values := compiled.Values(expression.Variables())
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := compiled.Eval(values); err != nil {
+			b.Fatalf("Eval failed, %s", err)
+		}
+	}
+}
+
+func BenchmarkProgramFunctions(b *testing.B) {
+
+	expression, err := GetExpression("g(x) = h(x) + h(x) + h(x); h(x) = k(x)*2; k(x) = x + 1; g(y)")
+	if err != nil {
+		b.Fatalf("Problem setting up expression, %s", err)
+	}
+	expression.SetVariables(map[string]float64{"y": 2})
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := expression.Eval(); err != nil {
+			b.Fatalf("Eval failed, %s", err)
+		}
+	}
+}
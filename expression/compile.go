@@ -0,0 +1,335 @@
+package expression
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+type compiledNode func(vars []float64) (float64, error)
+
+// Compiled is an expression compiled for fast repeated evaluation.
+// Each variable is bound to a slot in the slice passed to Eval, globals and functions are bound when compiling.
+// A Compiled is not safe for concurrent use.
+type Compiled struct {
+	root  compiledNode
+	names []string
+	slots map[string]int
+	// the values of the names assigned by the expression
+	locals []float64
+}
+
+// Compile compiles the expression using its current globals and functions.
+// Variables are given slots in the order of their names, see Names and Slot.
+// Changing the globals or functions of the expression afterwards doesn't change the compiled expression.
+// Calls of defined functions are compiled by inlining their bodies.
+func (e *Expression) Compile() (*Compiled, error) {
+
+	var names []string
+	for name := range e.VariableNames() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	c := &Compiled{
+		names: names,
+		slots: map[string]int{},
+	}
+	for i, name := range names {
+		c.slots[name] = i
+	}
+
+	inlined, err := e.inline(e.root, nil, usedNames(e.root))
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := e.compile(inlined, c, map[string]int{})
+	if err != nil {
+		return nil, err
+	}
+	c.root = root
+
+	return c, nil
+}
+
+// Names returns the names of the variables in slot order.
+func (c *Compiled) Names() []string {
+	return c.names
+}
+
+// Slot returns the slot of the variable with the given name and whether it exists.
+func (c *Compiled) Slot(name string) (int, bool) {
+	slot, ok := c.slots[name]
+	return slot, ok
+}
+
+// Values creates a slice of slots containing the values of the variables in the map.
+func (c *Compiled) Values(variables map[string]float64) []float64 {
+	values := make([]float64, len(c.names))
+	for i, name := range c.names {
+		values[i] = variables[name]
+	}
+	return values
+}
+
+// Eval evaluates the expression with the variables given in slot order.
+// It does not allocate unless a variadic function does.
+func (c *Compiled) Eval(vars []float64) (float64, error) {
+	if len(vars) < len(c.names) {
+		return 0.0, SyntaxError{
+			Description: fmt.Sprintf("Expected %d variables but got %d", len(c.names), len(vars)),
+		}
+	}
+	return c.root(vars)
+}
+
+func (e *Expression) compile(node Node, c *Compiled, locals map[string]int) (compiledNode, error) {
+
+	switch n := node.(type) {
+	case *NumberNode:
+		value := n.Value
+		return func(vars []float64) (float64, error) {
+			return value, nil
+		}, nil
+
+	case *VariableNode:
+		if local, ok := locals[n.Name]; ok {
+			return func(vars []float64) (float64, error) {
+				return c.locals[local], nil
+			}, nil
+		}
+
+		if value, ok := e.globVariables[n.Name]; ok {
+			return func(vars []float64) (float64, error) {
+				return value, nil
+			}, nil
+		}
+
+		slot := c.slots[n.Name]
+		return func(vars []float64) (float64, error) {
+			return vars[slot], nil
+		}, nil
+
+	case *UnaryNode:
+		operand, err := e.compile(n.Operand, c, locals)
+		if err != nil {
+			return nil, err
+		}
+
+		switch n.Operator {
+		case "-":
+			return func(vars []float64) (float64, error) {
+				v, err := operand(vars)
+				return -v, err
+			}, nil
+		case "!":
+			return func(vars []float64) (float64, error) {
+				v, err := operand(vars)
+				return truth(v == 0), err
+			}, nil
+		}
+		panic("The unary operator was an unrecognised type, this is a bug in the parser.")
+
+	case *PostfixNode:
+		operand, err := e.compile(n.Operand, c, locals)
+		if err != nil {
+			return nil, err
+		}
+
+		switch n.Operator {
+		case "!":
+			return func(vars []float64) (float64, error) {
+				v, err := operand(vars)
+				return factorial(v), err
+			}, nil
+		}
+		panic("The postfix operator was an unrecognised type, this is a bug in the parser.")
+
+	case *BinaryNode:
+		left, err := e.compile(n.Left, c, locals)
+		if err != nil {
+			return nil, err
+		}
+		right, err := e.compile(n.Right, c, locals)
+		if err != nil {
+			return nil, err
+		}
+
+		switch n.Operator {
+		case "&&", "||":
+			// the right operand is only evaluated if it decides the result
+			and := n.Operator == "&&"
+			return func(vars []float64) (float64, error) {
+				op1, err := left(vars)
+				if err != nil {
+					return 0.0, err
+				}
+				if (op1 != 0) != and {
+					return truth(op1 != 0), nil
+				}
+				op2, err := right(vars)
+				if err != nil {
+					return 0.0, err
+				}
+				return truth(op2 != 0), nil
+			}, nil
+		}
+
+		var f func(float64, float64) float64
+		switch n.Operator {
+		case "+":
+			f = func(a, b float64) float64 { return a + b }
+		case "-":
+			f = func(a, b float64) float64 { return a - b }
+		case "*":
+			f = func(a, b float64) float64 { return a * b }
+		case "/":
+			f = func(a, b float64) float64 { return a / b }
+		case "%":
+			f = modulo
+		case "//":
+			f = func(a, b float64) float64 { return math.Floor(a / b) }
+		case "^":
+			f = math.Pow
+		case "<":
+			f = func(a, b float64) float64 { return truth(a < b) }
+		case "<=":
+			f = func(a, b float64) float64 { return truth(a <= b) }
+		case ">":
+			f = func(a, b float64) float64 { return truth(a > b) }
+		case ">=":
+			f = func(a, b float64) float64 { return truth(a >= b) }
+		case "==":
+			f = func(a, b float64) float64 { return truth(a == b) }
+		case "!=":
+			f = func(a, b float64) float64 { return truth(a != b) }
+		default:
+			panic("The operator was an unrecognised type, this is a bug in the parser.")
+		}
+
+		return func(vars []float64) (float64, error) {
+			op1, err := left(vars)
+			if err != nil {
+				return 0.0, err
+			}
+			op2, err := right(vars)
+			if err != nil {
+				return 0.0, err
+			}
+			return f(op1, op2), nil
+		}, nil
+
+	case *ConditionalNode:
+		condition, err := e.compile(n.Condition, c, locals)
+		if err != nil {
+			return nil, err
+		}
+		then, err := e.compile(n.Then, c, locals)
+		if err != nil {
+			return nil, err
+		}
+		otherwise, err := e.compile(n.Else, c, locals)
+		if err != nil {
+			return nil, err
+		}
+
+		return func(vars []float64) (float64, error) {
+			c, err := condition(vars)
+			if err != nil {
+				return 0.0, err
+			}
+			if c != 0 {
+				return then(vars)
+			}
+			return otherwise(vars)
+		}, nil
+
+	case *AssignNode:
+		value, err := e.compile(n.Value, c, locals)
+		if err != nil {
+			return nil, err
+		}
+
+		local := len(c.locals)
+		c.locals = append(c.locals, 0)
+
+		inner := map[string]int{n.Name: local}
+		for name, l := range locals {
+			if name != n.Name {
+				inner[name] = l
+			}
+		}
+		body, err := e.compile(n.Body, c, inner)
+		if err != nil {
+			return nil, err
+		}
+
+		return func(vars []float64) (float64, error) {
+			v, err := value(vars)
+			if err != nil {
+				return 0.0, err
+			}
+			c.locals[local] = v
+			return body(vars)
+		}, nil
+
+	case *CallNode:
+		args := make([]compiledNode, len(n.Args))
+		for i, arg := range n.Args {
+			compiled, err := e.compile(arg, c, locals)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = compiled
+		}
+
+		if f, ok := e.functions[n.Name]; ok {
+			if len(args) != 1 {
+				return nil, SyntaxError{
+					Description: fmt.Sprintf("Function with name %s takes 1 parameter but got %d", n.Name, len(args)),
+					Position:    n.Span.Start,
+					End:         n.Span.End,
+				}
+			}
+
+			arg := args[0]
+			return func(vars []float64) (float64, error) {
+				v, err := arg(vars)
+				if err != nil {
+					return 0.0, err
+				}
+				return f(v), nil
+			}, nil
+		}
+
+		f, ok := e.variadicFunctions[n.Name]
+		if !ok {
+			return nil, SyntaxError{
+				Description: fmt.Sprintf("Function with name %s doesn't exist", n.Name),
+				Position:    n.Span.Start,
+				End:         n.Span.End,
+			}
+		}
+
+		// reuse the same slice for the arguments on every call to avoid allocating
+		values := make([]float64, len(args))
+		span := n.Span
+		return func(vars []float64) (float64, error) {
+			for i, arg := range args {
+				v, err := arg(vars)
+				if err != nil {
+					return 0.0, err
+				}
+				values[i] = v
+			}
+			v, err := f(values...)
+			if err != nil {
+				return 0.0, withSpan(err, span)
+			}
+			return v, nil
+		}, nil
+	}
+
+	panic("The node is not a valid node type, this should never happen")
+}
@@ -0,0 +1,148 @@
+package expression
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+
+	expressions := []string{
+		"2 * 3 + 2*(5 + 4 / 2) ^ 2",
+		"-x^2 + y/x - 3",
+		"sin(x)*pi + hypot(x, y)",
+		"-(-x)",
+		"if(x < y || !(x > 1), y, x*2) + (x >= 1.5 && y != 0)",
+		"y % x + y // x + x!",
+		"a = x*y; b = a + x; a = b*2; a + b + y",
+	}
+
+	variables := map[string]float64{
+		"x": 1.5,
+		"y": -4,
+	}
+
+	for _, expressionString := range expressions {
+		expr, err := GetExpression(expressionString)
+		if err != nil {
+			t.Fatalf("Problem setting up expression, %s", err)
+		}
+
+		expr.SetGlobals(map[string]float64{
+			"pi": math.Pi,
+		})
+		expr.SetFunctions(map[string]func(float64) float64{
+			"sin": math.Sin,
+		})
+		expr.SetVariadicFunctions(map[string]VariadicFunction{
+			"hypot": func(args ...float64) (float64, error) {
+				return math.Hypot(args[0], args[1]), nil
+			},
+		})
+		expr.SetVariables(variables)
+
+		expected, err := expr.Eval()
+		if err != nil {
+			t.Fatalf("Unexpected Error\n%s", err)
+		}
+
+		compiled, err := expr.Compile()
+		if err != nil {
+			t.Fatalf("Compile of %s failed, %s", expressionString, err)
+		}
+
+		result, err := compiled.Eval(compiled.Values(variables))
+		if err != nil {
+			t.Fatalf("Unexpected Error\n%s", err)
+		}
+
+		if result != expected {
+			t.Errorf("Compiled %s gave %f but Eval gave %f", expressionString, result, expected)
+		}
+	}
+}
+
+func TestCompileSlots(t *testing.T) {
+	expr, err := GetExpression("c*b + a + e")
+	if err != nil {
+		t.Fatalf("Problem setting up expression, %s", err)
+	}
+	expr.SetGlobals(map[string]float64{
+		"e": math.E,
+	})
+
+	compiled, err := expr.Compile()
+	if err != nil {
+		t.Fatalf("Compile failed, %s", err)
+	}
+
+	names := compiled.Names()
+	if len(names) != 3 || names[0] != "a" || names[1] != "b" || names[2] != "c" {
+		t.Fatalf("Expected the variables a, b and c but got %v", names)
+	}
+
+	if slot, ok := compiled.Slot("c"); !ok || slot != 2 {
+		t.Errorf("Expected c to be in slot 2 but got %d", slot)
+	}
+	if _, ok := compiled.Slot("e"); ok {
+		t.Errorf("Expected globals to not have a slot")
+	}
+
+	result, err := compiled.Eval([]float64{1, 2, 3})
+	if err != nil {
+		t.Fatalf("Unexpected Error\n%s", err)
+	}
+
+	if result != 7+math.E {
+		t.Fatalf("Unexpected answer, expected %f but got %f", 7+math.E, result)
+	}
+
+	if _, err := compiled.Eval([]float64{1}); err == nil {
+		t.Fatal("Expected an error for too few variables but got nothing.")
+	}
+}
+
+func TestCompileUnknownFunction(t *testing.T) {
+	for _, expressionString := range []string{"unknown(x)", "sin(x, 2)"} {
+		expr, err := GetExpression(expressionString)
+		if err != nil {
+			t.Fatalf("Problem setting up expression, %s", err)
+		}
+		expr.SetFunctions(map[string]func(float64) float64{
+			"sin": math.Sin,
+		})
+
+		if _, err := expr.Compile(); err == nil {
+			t.Errorf("Expected an error compiling %s but got nothing.", expressionString)
+		}
+	}
+}
+
+func TestCompileDoesNotAllocate(t *testing.T) {
+	expr, err := GetExpression("max(x, y) * -x + sqrt(y)")
+	if err != nil {
+		t.Fatalf("Problem setting up expression, %s", err)
+	}
+	expr.SetFunctions(map[string]func(float64) float64{
+		"sqrt": math.Sqrt,
+	})
+	expr.SetVariadicFunctions(map[string]VariadicFunction{
+		"max": func(args ...float64) (float64, error) {
+			return math.Max(args[0], args[1]), nil
+		},
+	})
+
+	compiled, err := expr.Compile()
+	if err != nil {
+		t.Fatalf("Compile failed, %s", err)
+	}
+
+	values := []float64{2, 9}
+	allocs := testing.AllocsPerRun(100, func() {
+		compiled.Eval(values)
+	})
+
+	if allocs != 0 {
+		t.Fatalf("Expected no allocations but got %f", allocs)
+	}
+}
@@ -0,0 +1,385 @@
+package expression
+
+import (
+	"fmt"
+)
+
+// derivatives of the functions of the standard library written in terms of x, the argument of the function.
+// Functions that are constant apart from where they jump have a derivative of 0.
+var defaultDerivatives = map[string]string{
+	"sin":   "cos(x)",
+	"cos":   "-sin(x)",
+	"tan":   "1/cos(x)^2",
+	"asin":  "1/sqrt(1 - x^2)",
+	"acos":  "-1/sqrt(1 - x^2)",
+	"atan":  "1/(1 + x^2)",
+	"sinh":  "cosh(x)",
+	"cosh":  "sinh(x)",
+	"tanh":  "1/cosh(x)^2",
+	"asinh": "1/sqrt(x^2 + 1)",
+	"acosh": "1/sqrt(x^2 - 1)",
+	"atanh": "1/(1 - x^2)",
+	"ln":    "1/x",
+	"log":   "1/(x*2.302585092994046)",
+	"sqrt":  "1/(2*sqrt(x))",
+	"cbrt":  "1/(3*cbrt(x)^2)",
+	"exp":   "exp(x)",
+	"abs":   "sign(x)",
+	"sign":  "0",
+	"floor": "0",
+	"ceil":  "0",
+	"round": "0",
+	"trunc": "0",
+	"erf":   "1.1283791670955126*exp(-(x^2))",
+	"erfc":  "-1.1283791670955126*exp(-(x^2))",
+}
+
+// SetDerivatives sets the derivatives of functions used by Derive.
+// Each derivative is an expression of the variable x which stands for the argument of the function, eg. "cos(x)" for sin.
+// Derivatives of the functions of a single parameter in the standard library, apart from gamma and lgamma, and of log(x) are known already.
+// They are overridden by any set here.
+func (e *Expression) SetDerivatives(derivatives map[string]*Expression) {
+	e.derivatives = derivatives
+}
+
+// Derive symbolically differentiates the expression with respect to the variable given.
+// The result is a new Expression sharing the globals, functions and derivatives of this one,
+// with a copy of the values of its variables, so they can be changed separately.
+// Functions of the variable can only be differentiated if they take a single parameter and their derivative is known.
+// Comparisons and logical operators are treated as constant, so the derivative of if(c, a, b) is if(c, a', b').
+// Names assigned in a program have their derivatives assigned alongside them, to the name with d in front, eg. dr,
+// or followed by a number if that is already used, eg. dr1.
+// Calls of defined functions are replaced by their bodies before differentiating, with the arguments assigned at the start
+// of the statement to the name of the function followed by the parameter, eg. fx.
+// Floor division is also treated as constant, and factorials can only be differentiated if they don't depend on the variable.
+func (e *Expression) Derive(variable string) (*Expression, error) {
+
+	root, err := e.inline(e.root, nil, usedNames(e.root))
+	if err != nil {
+		return nil, err
+	}
+	root = hoistAssignments(root)
+
+	// every assigned name gets the same name for its derivative, which doesn't match any other name in the tree
+	taken := usedNames(root)
+	names := map[string]string{}
+	Inspect(root, func(n Node) bool {
+		if a, ok := n.(*AssignNode); ok && names[a.Name] == "" {
+			names[a.Name] = freshName("d"+a.Name, taken)
+		}
+		return true
+	})
+
+	root, err = e.derive(root, variable, map[string]string{}, names)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.withRoot(root), nil
+}
+
+// derive returns the derivative of the node with respect to the variable.
+// Assigned maps the names assigned so far to the names their derivatives are assigned to, or an empty string if the derivative is 0.
+// Names gives the name of the derivative of every name assigned in the tree.
+func (e *Expression) derive(node Node, variable string, assigned map[string]string, names map[string]string) (Node, error) {
+
+	switch n := node.(type) {
+	case *NumberNode:
+		return number(0), nil
+
+	case *VariableNode:
+		if derivative, ok := assigned[n.Name]; ok {
+			if derivative == "" {
+				return number(0), nil
+			}
+			return &VariableNode{Name: derivative}, nil
+		}
+		if _, global := e.globVariables[n.Name]; !global && n.Name == variable {
+			return number(1), nil
+		}
+		return number(0), nil
+
+	case *UnaryNode:
+		if n.Operator == "!" {
+			// logical operators are constant apart from where they jump
+			return number(0), nil
+		}
+
+		d, err := e.derive(n.Operand, variable, assigned, names)
+		if err != nil {
+			return nil, err
+		}
+
+		switch n.Operator {
+		case "-":
+			return binary("-", number(0), d), nil
+		}
+		panic("The unary operator was an unrecognised type, this is a bug in the parser.")
+
+	case *PostfixNode:
+		d, err := e.derive(n.Operand, variable, assigned, names)
+		if err != nil {
+			return nil, err
+		}
+		if isValue(d, 0) {
+			return number(0), nil
+		}
+		return nil, SyntaxError{
+			Description: fmt.Sprintf("Cannot differentiate the %s operator", n.Operator),
+			Position:    n.Span.Start,
+			End:         n.Span.End,
+		}
+
+	case *BinaryNode:
+		if operatorPrecedence(n.Operator) < operatorPrecedence("+") {
+			// comparison and logical operators are constant apart from where they jump
+			return number(0), nil
+		}
+
+		f, g := n.Left, n.Right
+
+		df, err := e.derive(f, variable, assigned, names)
+		if err != nil {
+			return nil, err
+		}
+		dg, err := e.derive(g, variable, assigned, names)
+		if err != nil {
+			return nil, err
+		}
+
+		switch n.Operator {
+		case "+", "-":
+			return binary(n.Operator, df, dg), nil
+		case "%":
+			// a % b = a - b*(a // b) where a // b is constant apart from where it jumps
+			return binary("-", df, binary("*", dg, &BinaryNode{Operator: "//", Left: f, Right: g})), nil
+		case "//":
+			return number(0), nil
+		case "*":
+			return binary("+",
+				binary("*", df, g),
+				binary("*", f, dg),
+			), nil
+		case "/":
+			return binary("/",
+				binary("-",
+					binary("*", df, g),
+					binary("*", f, dg),
+				),
+				binary("^", g, number(2)),
+			), nil
+		case "^":
+			if isValue(dg, 0) {
+				// power rule
+				return binary("*",
+					binary("*", g, binary("^", f, binary("-", g, number(1)))),
+					df,
+				), nil
+			}
+
+			// d(f^g) = f^g * (g' ln(f) + g f' / f)
+			return binary("*",
+				binary("^", f, g),
+				binary("+",
+					binary("*", dg, &CallNode{Name: "ln", Args: []Node{f}}),
+					binary("/", binary("*", g, df), f),
+				),
+			), nil
+		}
+		panic("The operator was an unrecognised type, this is a bug in the parser.")
+
+	case *ConditionalNode:
+		then, err := e.derive(n.Then, variable, assigned, names)
+		if err != nil {
+			return nil, err
+		}
+		otherwise, err := e.derive(n.Else, variable, assigned, names)
+		if err != nil {
+			return nil, err
+		}
+
+		if isValue(then, 0) && isValue(otherwise, 0) {
+			return number(0), nil
+		}
+		return &ConditionalNode{
+			Condition: n.Condition,
+			Then:      then,
+			Else:      otherwise,
+		}, nil
+
+	case *AssignNode:
+		value, err := e.derive(n.Value, variable, assigned, names)
+		if err != nil {
+			return nil, err
+		}
+
+		derivative := names[n.Name]
+		inner := map[string]string{n.Name: derivative}
+		if isValue(value, 0) {
+			inner[n.Name] = ""
+		}
+		for name, d := range assigned {
+			if name != n.Name {
+				inner[name] = d
+			}
+		}
+
+		body, err := e.derive(n.Body, variable, inner, names)
+		if err != nil {
+			return nil, err
+		}
+
+		if inner[n.Name] != "" {
+			body = assign(derivative, value, body)
+		}
+		return assign(n.Name, n.Value, body), nil
+
+	case *CallNode:
+		constant := true
+		derivatives := make([]Node, len(n.Args))
+		for i, arg := range n.Args {
+			d, err := e.derive(arg, variable, assigned, names)
+			if err != nil {
+				return nil, err
+			}
+			derivatives[i] = d
+			constant = constant && isValue(d, 0)
+		}
+
+		if constant {
+			return number(0), nil
+		}
+
+		outer, err := e.functionDerivative(n.Name, len(n.Args))
+		if err != nil {
+			return nil, withSpan(err, n.Span)
+		}
+
+		return binary("*", replaceVariable(outer, "x", n.Args[0]), derivatives[0]), nil
+	}
+
+	panic("The node is not a valid node type, this should never happen")
+}
+
+// functionDerivative gets the derivative of the function in terms of the variable x.
+func (e *Expression) functionDerivative(name string, arity int) (Node, error) {
+
+	if arity != 1 {
+		return nil, SyntaxError{
+			Description: fmt.Sprintf("Cannot differentiate function %s with %d parameters", name, arity),
+		}
+	}
+
+	if derivative, ok := e.derivatives[name]; ok {
+		return derivative.root, nil
+	}
+
+	if derivative, ok := defaultDerivatives[name]; ok {
+		expr, err := GetExpression(derivative)
+		if err != nil {
+			return nil, err
+		}
+		return expr.root, nil
+	}
+
+	return nil, SyntaxError{
+		Description: fmt.Sprintf("Derivative of function %s is unknown", name),
+	}
+}
+
+// replaceVariable replaces every occurrence of the variable with the replacement.
+func replaceVariable(node Node, name string, replacement Node) Node {
+	return Rewrite(node, func(n Node) Node {
+		if v, ok := n.(*VariableNode); ok && v.Name == name {
+			return replacement
+		}
+		return n
+	})
+}
+
+// binary combines the operands with the operator, folding constants and removing identities where it can.
+func binary(operator string, left Node, right Node) Node {
+
+	l, lNumber := left.(*NumberNode)
+	r, rNumber := right.(*NumberNode)
+
+	if lNumber && rNumber {
+		switch operator {
+		case "+":
+			return number(l.Value + r.Value)
+		case "-":
+			return number(l.Value - r.Value)
+		case "*":
+			return number(l.Value * r.Value)
+		}
+	}
+
+	switch operator {
+	case "+":
+		if isValue(left, 0) {
+			return right
+		}
+		if isValue(right, 0) {
+			return left
+		}
+	case "-":
+		if isValue(right, 0) {
+			return left
+		}
+		if isValue(left, 0) {
+			return &UnaryNode{
+				Operator: "-",
+				Operand:  right,
+			}
+		}
+	case "*":
+		if isValue(left, 0) || isValue(right, 0) {
+			return number(0)
+		}
+		if isValue(left, 1) {
+			return right
+		}
+		if isValue(right, 1) {
+			return left
+		}
+	case "/":
+		if isValue(left, 0) {
+			return number(0)
+		}
+		if isValue(right, 1) {
+			return left
+		}
+	case "^":
+		if isValue(right, 1) {
+			return left
+		}
+	}
+
+	return &BinaryNode{
+		Operator: operator,
+		Left:     left,
+		Right:    right,
+	}
+}
+
+// assign assigns the value to the name in the body, leaving out the assignment if the body doesn't use the name.
+func assign(name string, value Node, body Node) Node {
+	if _, used := freeNames(body)[name]; !used {
+		return body
+	}
+	return &AssignNode{
+		Name:  name,
+		Value: value,
+		Body:  body,
+	}
+}
+
+func number(value float64) Node {
+	return &NumberNode{Value: value}
+}
+
+// isValue checks if the node is a number literal with the value given.
+func isValue(node Node, value float64) bool {
+	n, ok := node.(*NumberNode)
+	return ok && n.Value == value
+}
@@ -0,0 +1,202 @@
+package expression
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDerive(t *testing.T) {
+
+	functions := map[string]func(float64) float64{
+		"sin":  math.Sin,
+		"cos":  math.Cos,
+		"tan":  math.Tan,
+		"ln":   math.Log,
+		"sqrt": math.Sqrt,
+		"exp":  math.Exp,
+	}
+
+	tests := []struct {
+		expression string
+		derivative func(x, y float64) float64
+	}{
+		{"2*x^2", func(x, y float64) float64 { return 4 * x }},
+		{"x^2 + 2*y^2 + 5", func(x, y float64) float64 { return 2 * x }},
+		{"x*y - x/y", func(x, y float64) float64 { return y - 1/y }},
+		{"y/x", func(x, y float64) float64 { return -y / (x * x) }},
+		{"-x^3", func(x, y float64) float64 { return -3 * x * x }},
+		{"sin(x^2)", func(x, y float64) float64 { return math.Cos(x*x) * 2 * x }},
+		{"cos(y*x)", func(x, y float64) float64 { return -math.Sin(y*x) * y }},
+		{"ln(sqrt(x))", func(x, y float64) float64 { return 1 / (2 * x) }},
+		{"tan(x)", func(x, y float64) float64 { return 1 / math.Pow(math.Cos(x), 2) }},
+		{"x^x", func(x, y float64) float64 { return math.Pow(x, x) * (math.Log(x) + 1) }},
+		{"2^(y*x)", func(x, y float64) float64 { return math.Pow(2, y*x) * y * math.Log(2) }},
+		{"exp(-x)", func(x, y float64) float64 { return -math.Exp(-x) }},
+		{"sin(y)", func(x, y float64) float64 { return 0 }},
+		{"if(x < 1, x, y*x^2)", func(x, y float64) float64 { return 2 * y * x }},
+		{"(x > y)*x", func(x, y float64) float64 { return 1 }},
+		{"x^2 % y", func(x, y float64) float64 { return 2 * x }},
+		{"x*(2*y)! + x // y", func(x, y float64) float64 { return math.Gamma(2.4) }},
+		{"a = x^2; b = a*y; a = sin(b); a + b", func(x, y float64) float64 { return math.Cos(x*x*y)*2*x*y + 2*x*y }},
+		{"x = x*2; y = 3; x^2 + y", func(x, y float64) float64 { return 8 * x }},
+	}
+
+	const tolerance = 1e-9
+
+	for _, test := range tests {
+		expr, err := GetExpression(test.expression)
+		if err != nil {
+			t.Fatalf("Problem setting up expression, %s", err)
+		}
+
+		expr.SetFunctions(functions)
+		expr.SetVariables(map[string]float64{
+			"x": 1.3,
+			"y": 0.7,
+		})
+
+		derived, err := expr.Derive("x")
+		if err != nil {
+			t.Fatalf("Derive of %s failed, %s", test.expression, err)
+		}
+
+		result, err := derived.Eval()
+		if err != nil {
+			t.Fatalf("Evaluating derivative of %s failed, %s", test.expression, err)
+		}
+
+		expected := test.derivative(1.3, 0.7)
+		if math.Abs(result-expected) > tolerance {
+			t.Errorf("Derivative of %s incorrect, expected %f but got %f", test.expression, expected, result)
+		}
+	}
+}
+
+func TestDeriveTwice(t *testing.T) {
+	expr, err := GetExpression("x^3 + e^x")
+	if err != nil {
+		t.Fatalf("Problem setting up expression, %s", err)
+	}
+
+	expr.SetGlobals(map[string]float64{
+		"e": math.E,
+	})
+	expr.SetFunctions(map[string]func(float64) float64{
+		"ln": math.Log,
+	})
+
+	first, err := expr.Derive("x")
+	if err != nil {
+		t.Fatalf("Derive failed, %s", err)
+	}
+
+	second, err := first.Derive("x")
+	if err != nil {
+		t.Fatalf("Derive failed, %s", err)
+	}
+
+	second.SetVariables(map[string]float64{
+		"x": 2,
+	})
+
+	result, err := second.Eval()
+	if err != nil {
+		t.Fatalf("Evaluating derivative failed, %s", err)
+	}
+
+	expected := 12 + math.E*math.E
+	if math.Abs(result-expected) > 1e-9 {
+		t.Fatalf("Second derivative incorrect, expected %f but got %f", expected, result)
+	}
+}
+
+func TestDeriveProgramParsesBack(t *testing.T) {
+	tests := map[string]string{
+		"r = x^2; r*3":                 "dr = 2 * x; dr * 3",
+		"r = x^2; dr = 1; r*dr":        "dr1 = 2 * x; dr = 1; dr1 * dr",
+		"r = x^2; r = r*x; r + dr":     "r = x^2; dr1 = 2 * x; r = r * x; dr1 = dr1 * x + r; dr1",
+		"a1 = x; a2 = a1^2; a2 + a1*y": "a1 = x; da1 = 1; da2 = 2 * a1 * da1; da2 + da1 * y",
+		// the parameters of inlined functions are assigned at the start of the statement
+		"f(y) = y^2; f(x) + 1":        "f(y) = y^2; fy = x; dfy = 1; 2 * fy * dfy",
+		"f(y) = y^2; fy = 2; f(x)*fy": "f(y) = y^2; fy = 2; fy1 = x; dfy1 = 1; 2 * fy1 * dfy1 * fy",
+	}
+
+	for expression, expected := range tests {
+		expr, err := GetExpression(expression)
+		if err != nil {
+			t.Fatalf("Problem setting up expression, %s", err)
+		}
+		expr.SetVariables(map[string]float64{"x": 1.5, "y": 2, "dr": 4})
+
+		derived, err := expr.Derive("x")
+		if err != nil {
+			t.Fatalf("Derive of %s failed, %s", expression, err)
+		}
+		if derived.String() != expected {
+			t.Errorf("Expected the derivative of %s to be %s but got %s", expression, expected, derived.String())
+		}
+
+		parsed, err := GetExpression(derived.String())
+		if err != nil {
+			t.Errorf("The derivative of %s doesn't parse back, %s", expression, err)
+			continue
+		}
+		parsed.SetVariables(derived.Variables())
+		want, err := derived.Eval()
+		if err != nil {
+			t.Fatalf("Evaluating derivative of %s failed, %s", expression, err)
+		}
+		if got, err := parsed.Eval(); err != nil || got != want {
+			t.Errorf("Expected the parsed derivative of %s to be %f but got %f, %v", expression, want, got, err)
+		}
+	}
+}
+
+func TestDeriveCustomDerivative(t *testing.T) {
+	expr, err := GetExpression("square(3*x)")
+	if err != nil {
+		t.Fatalf("Problem setting up expression, %s", err)
+	}
+
+	derivative, err := GetExpression("2*x")
+	if err != nil {
+		t.Fatalf("Problem setting up expression, %s", err)
+	}
+
+	expr.SetDerivatives(map[string]*Expression{
+		"square": derivative,
+	})
+
+	derived, err := expr.Derive("x")
+	if err != nil {
+		t.Fatalf("Derive failed, %s", err)
+	}
+
+	derived.SetVariables(map[string]float64{
+		"x": 2,
+	})
+
+	result, err := derived.Eval()
+	if err != nil {
+		t.Fatalf("Evaluating derivative failed, %s", err)
+	}
+
+	if result != 36 {
+		t.Fatalf("Derivative incorrect, expected %f but got %f", 36.0, result)
+	}
+}
+
+func TestDeriveUnknownFunction(t *testing.T) {
+	expr, err := GetExpression("unknown(x) + max(x, 2)")
+	if err != nil {
+		t.Fatalf("Problem setting up expression, %s", err)
+	}
+
+	if _, err := expr.Derive("x"); err == nil {
+		t.Fatal("Expected an error but got nothing.")
+	}
+
+	if _, err := expr.Derive("y"); err != nil {
+		t.Fatalf("Functions not depending on the variable shouldn't need derivatives, got %s", err)
+	}
+}
@@ -5,162 +5,332 @@ import (
 	"math"
 )
 
-func evaluateShunted(input []token, locals map[string]float64, globals map[string]float64, functions map[string]func(float64) float64) (float64, error) {
+// scope holds the values of the names assigned while evaluating, the innermost assignment first.
+type scope struct {
+	name   string
+	value  float64
+	parent *scope
+	// definition is set to the name of a defined function for the scope its body is called in.
+	// The body can't see the names of its caller, which are in the parents of this scope.
+	definition string
+}
 
-	stack := []float64{}
+func (s *scope) lookup(name string) (float64, bool) {
+	for ; s != nil && s.definition == ""; s = s.parent {
+		if s.name == name {
+			return s.value, true
+		}
+	}
+	return 0, false
+}
 
-	for _, t := range input {
-		if t.kind == tokenOperator {
+// inDefinition checks if the scope is in the body of a defined function.
+func (s *scope) inDefinition() bool {
+	for ; s != nil; s = s.parent {
+		if s.definition != "" {
+			return true
+		}
+	}
+	return false
+}
 
-			operator := t.value.(rune)
+// evaluate recursively evaluates the node with the variables and functions of the expression and the names assigned in the scope.
+func (e *Expression) evaluate(node Node, s *scope) (float64, error) {
 
-			if len(stack) < 2 {
-				return 0.0, SyntaxError{
-					Description: "Not enough parameters for operator",
-				}
-			}
+	switch n := node.(type) {
+	case *NumberNode:
+		return n.Value, nil
 
-			var op1, op2 float64
-			op2, stack = stack[len(stack)-1], stack[:len(stack)-1]
-			op1, stack = stack[len(stack)-1], stack[:len(stack)-1]
-
-			var result float64
-			switch operator {
-			case '+':
-				result = op1 + op2
-			case '-':
-				result = op1 - op2
-			case '*':
-				result = op1 * op2
-			case '/':
-				result = op1 / op2
-			case '^':
-				result = math.Pow(op1, op2)
+	case *VariableNode:
+		if v, ok := s.lookup(n.Name); ok {
+			return v, nil
+		}
+		if v, ok := e.globVariables[n.Name]; ok {
+			return v, nil
+		}
+		if s.inDefinition() {
+			return 0.0, SyntaxError{
+				Description: fmt.Sprintf("Variable with name %s is not a parameter", n.Name),
+				Position:    n.Span.Start,
+				End:         n.Span.End,
 			}
+		}
+		if v, ok := e.variables[n.Name]; ok {
+			return v, nil
+		}
+		return 0.0, SyntaxError{
+			Description: fmt.Sprintf("Variable with name %s doesn't exist", n.Name),
+			Position:    n.Span.Start,
+			End:         n.Span.End,
+		}
 
-			stack = append(stack, result)
+	case *UnaryNode:
+		op, err := e.evaluate(n.Operand, s)
+		if err != nil {
+			return 0.0, err
+		}
 
+		switch n.Operator {
+		case "-":
+			return -op, nil
+		case "!":
+			return truth(op == 0), nil
 		}
+		panic("The unary operator was an unrecognised type, this is a bug in the parser.")
 
-		if t.kind == tokenNumber {
-			stack = append(stack, t.value.(float64))
+	case *PostfixNode:
+		op, err := e.evaluate(n.Operand, s)
+		if err != nil {
+			return 0.0, err
 		}
 
-		if t.kind == tokenVariable {
-			name := t.value.(string)
-			var v float64
-			vGlobal, okGlobal := globals[name]
-			vLocal, okLocal := locals[name]
+		switch n.Operator {
+		case "!":
+			return factorial(op), nil
+		}
+		panic("The postfix operator was an unrecognised type, this is a bug in the parser.")
 
-			if okGlobal {
-				v = vGlobal
-			} else if okLocal {
-				v = vLocal
-			} else {
-				return 0.0, SyntaxError{
-					Description: fmt.Sprintf("Variable with name %s doesn't exist", name),
-				}
-			}
-			stack = append(stack, v)
+	case *BinaryNode:
+		op1, err := e.evaluate(n.Left, s)
+		if err != nil {
+			return 0.0, err
 		}
 
-		if t.kind == tokenFunction {
+		// the right operand of a logical operator is only evaluated if it decides the result
+		if (n.Operator == "&&" && op1 == 0) || (n.Operator == "||" && op1 != 0) {
+			return truth(op1 != 0), nil
+		}
 
-			var f func(float64) float64
+		op2, err := e.evaluate(n.Right, s)
+		if err != nil {
+			return 0.0, err
+		}
 
-			if _, ok := t.value.(reservedFunction); ok {
-				name := t.value.(reservedFunction)
-				switch name {
-				case negateFunction:
-					f = func(v float64) float64 {
-						return -v
-					}
-				default:
-					panic("The internal function is somehow not a valid internal function, this should never happen")
-				}
-			} else {
-				name := t.value.(string)
-				var ok bool
-				f, ok = functions[name]
-				if !ok {
-					return 0.0, SyntaxError{
-						Description: fmt.Sprintf("Function with name %s doesn't exist", name),
-					}
-				}
+		switch n.Operator {
+		case "+":
+			return op1 + op2, nil
+		case "-":
+			return op1 - op2, nil
+		case "*":
+			return op1 * op2, nil
+		case "/":
+			return op1 / op2, nil
+		case "%":
+			return modulo(op1, op2), nil
+		case "//":
+			return math.Floor(op1 / op2), nil
+		case "^":
+			return math.Pow(op1, op2), nil
+		case "<":
+			return truth(op1 < op2), nil
+		case "<=":
+			return truth(op1 <= op2), nil
+		case ">":
+			return truth(op1 > op2), nil
+		case ">=":
+			return truth(op1 >= op2), nil
+		case "==":
+			return truth(op1 == op2), nil
+		case "!=":
+			return truth(op1 != op2), nil
+		case "&&", "||":
+			return truth(op2 != 0), nil
+		}
+		panic("The operator was an unrecognised type, this is a bug in the parser.")
+
+	case *ConditionalNode:
+		condition, err := e.evaluate(n.Condition, s)
+		if err != nil {
+			return 0.0, err
+		}
+		if condition != 0 {
+			return e.evaluate(n.Then, s)
+		}
+		return e.evaluate(n.Else, s)
+
+	case *AssignNode:
+		v, err := e.evaluate(n.Value, s)
+		if err != nil {
+			return 0.0, err
+		}
+		return e.evaluate(n.Body, &scope{name: n.Name, value: v, parent: s})
+
+	case *CallNode:
+		args := make([]float64, len(n.Args))
+		for i, arg := range n.Args {
+			v, err := e.evaluate(arg, s)
+			if err != nil {
+				return 0.0, err
 			}
+			args[i] = v
+		}
+
+		if f, ok := e.definedFunctions[n.Name]; ok {
+			v, err := e.call(f, args, s)
+			return v, withSpan(err, n.Span)
+		}
 
-			if len(stack) < 1 {
+		if f, ok := e.functions[n.Name]; ok {
+			if len(args) != 1 {
 				return 0.0, SyntaxError{
-					Description: "Not enough parameters for function",
+					Description: fmt.Sprintf("Function with name %s takes 1 parameter but got %d", n.Name, len(args)),
+					Position:    n.Span.Start,
+					End:         n.Span.End,
 				}
 			}
-			var op1 float64
-			op1, stack = stack[len(stack)-1], stack[:len(stack)-1]
-
-			stack = append(stack, f(op1))
+			return f(args[0]), nil
+		}
 
+		f, ok := e.variadicFunctions[n.Name]
+		if !ok {
+			return 0.0, SyntaxError{
+				Description: fmt.Sprintf("Function with name %s doesn't exist", n.Name),
+				Position:    n.Span.Start,
+				End:         n.Span.End,
+			}
 		}
+		v, err := f(args...)
+		return v, withSpan(err, n.Span)
 	}
 
-	if len(stack) == 0 {
-		return 0.0, SyntaxError{
-			Description: "There is no value left on the stack, check expression",
-		}
+	panic("The node is not a valid node type, this should never happen")
+}
+
+// truth converts a boolean to 1 for true and 0 for false.
+func truth(b bool) float64 {
+	if b {
+		return 1
 	}
+	return 0
+}
 
-	return stack[0], nil
+// modulo finds the remainder of a divided by b with the same sign as b.
+func modulo(a float64, b float64) float64 {
+	m := math.Mod(a, b)
+	if m != 0 && (m < 0) != (b < 0) {
+		m += b
+	}
+	return m
+}
 
+// factorial calculates x!, using the gamma function for numbers that aren't whole.
+func factorial(x float64) float64 {
+	if x >= 0 && x <= 170 && x == math.Trunc(x) {
+		// multiplying gives exact results for whole numbers where the gamma function may not
+		result := 1.0
+		for i := 2.0; i <= x; i++ {
+			result *= i
+		}
+		return result
+	}
+	return math.Gamma(x + 1)
 }
 
 // EvalExpression evaluates an expression that has no functions or variables
 func EvalExpression(input string) (result float64, err error) {
 
-	tokens, err := tokenizer(input)
+	expr, err := GetExpression(input)
 	if err != nil {
 		return
 	}
-	shunted, err := shuntingYard(tokens)
 
-	if err != nil {
-		return
-	}
-
-	result, err = evaluateShunted(shunted, map[string]float64{}, map[string]float64{}, map[string]func(float64) float64{})
+	expr.SetVariables(map[string]float64{})
+	result, err = expr.Eval()
 	return
 
 }
 
-// GetExpression creates an Expression
+// GetExpression creates an Expression.
+// The input may be a program of statements separated by semicolons, eg. r = sqrt(x^2 + y^2); theta = atan(y/x); r*theta.
+// Every statement but the last assigns a name which can be used by the statements after it, and the last statement gives the value.
+// A statement may also define a function, eg. f(x) = x^2 + 1; f(3), which is one statement so its body can't be a program.
+// Functions defined this way can be called anywhere in the program and are added to the defined functions of the expression.
 func GetExpression(input string) (*Expression, error) {
+	return GetExpressionWithOptions(input, ParseOptions{})
+}
+
+// GetExpressionWithOptions creates an Expression, parsing it with the options given.
+// With options.Recover the expression is returned even if there are errors, which are returned as SyntaxErrors.
+func GetExpressionWithOptions(input string, options ParseOptions) (*Expression, error) {
+
+	errs := &errorList{recover: options.Recover}
 
-	tokens, err := tokenizer(input)
+	tokens, err := tokenizer(input, options, errs)
 	if err != nil {
 		return &Expression{}, err
 	}
-	shunted, err := shuntingYard(tokens)
+	if options.Recover {
+		tokens = repair(tokens, errs)
+	}
 
+	root, functions, err := parseProgram(tokens, errs)
 	if err != nil {
 		return &Expression{}, err
 	}
 
+	expr := NewExpression(root)
+	if len(functions) != 0 {
+		// their recursion was checked as they were parsed
+		expr.programFunctions = functions
+		expr.definedFunctions = functions
+	}
+
+	return expr, errs.err()
+
+}
+
+// NewExpression creates an Expression from a syntax tree, eg. one that has been built or rewritten programmatically.
+func NewExpression(root Node) *Expression {
+
 	expr := &Expression{
-		shunted:   shunted,
-		variables: map[string]float64{},
-		functions: map[string]func(float64) float64{},
-		changedVariables: true,
+		root:              root,
+		variables:         map[string]float64{},
+		functions:         map[string]func(float64) float64{},
+		variadicFunctions: map[string]VariadicFunction{},
+		changedVariables:  true,
 	}
 	expr.Variables()
 
-	return expr, nil
+	return expr
 
 }
 
+// withRoot creates a new Expression for the tree which shares the globals, functions and derivatives of this one.
+// The values of the variables are copied, so they can be changed separately.
+func (e *Expression) withRoot(root Node) *Expression {
+
+	variables := map[string]float64{}
+	for name, value := range e.variables {
+		variables[name] = value
+	}
+
+	expr := &Expression{
+		root:              root,
+		variables:         variables,
+		globVariables:     e.globVariables,
+		functions:         e.functions,
+		variadicFunctions: e.variadicFunctions,
+		definedFunctions:  e.definedFunctions,
+		programFunctions:  e.programFunctions,
+		derivatives:       e.derivatives,
+		changedVariables:  true,
+	}
+	expr.Variables()
+
+	return expr
+}
+
 // The Expression type contains a parsed expression and the variables and functions that can calculate a value
 type Expression struct {
-	shunted          []token
-	variables        map[string]float64
-	globVariables    map[string]float64
-	functions        map[string]func(float64) float64
+	root              Node
+	variables         map[string]float64
+	globVariables     map[string]float64
+	functions         map[string]func(float64) float64
+	variadicFunctions map[string]VariadicFunction
+	definedFunctions  map[string]*Function
+	// the functions defined by the program the expression was parsed from, which are always defined
+	programFunctions map[string]*Function
+	derivatives      map[string]*Expression
 	changedVariables bool
 }
 
@@ -181,26 +351,36 @@ func (e *Expression) SetGlobals(variables map[string]float64) {
 
 // SetFunctions sets the functions to be used in the Eval
 // Functions may only accept a single value and return a single value.
-// This limitation may be relaxed in the future, and may accept multiple inputs.
+// Functions accepting multiple inputs can be set with SetVariadicFunctions.
 func (e *Expression) SetFunctions(functions map[string]func(float64) float64) {
 	e.functions = functions
 }
 
+// SetVariadicFunctions sets the functions that can accept any number of parameters, eg. max(a, b, c).
+// A function set with SetFunctions takes priority over a variadic function of the same name.
+func (e *Expression) SetVariadicFunctions(functions map[string]VariadicFunction) {
+	e.variadicFunctions = functions
+}
+
 // Eval evaluates the expression with the provided variables and functions
 func (e *Expression) Eval() (float64, error) {
 
-	return evaluateShunted(e.shunted, e.variables, e.globVariables, e.functions)
+	return e.evaluate(e.root, nil)
+}
+
+// Root returns the root of the syntax tree of the expression.
+// The tree should not be modified, use Rewrite to create a modified copy and NewExpression to use it.
+func (e *Expression) Root() Node {
+	return e.root
 }
 
 // VariableNames returns a map with the keys set to the names of the variables present in the expression.
-// It excludes the so called 'Global Variables' from the list.
+// It excludes the so called 'Global Variables' and names that are assigned before they are used from the list.
 func (e *Expression) VariableNames() map[string]struct{} {
 	names := map[string]struct{}{}
-	for _, t := range e.shunted {
-		if t.kind == tokenVariable {
-			if _, exists := e.globVariables[t.value.(string)]; !exists {
-				names[t.value.(string)] = struct{}{}
-			}
+	for name := range freeNames(e.root) {
+		if _, exists := e.globVariables[name]; !exists {
+			names[name] = struct{}{}
 		}
 	}
 	return names
@@ -228,12 +408,11 @@ func (e *Expression) Variables() map[string]float64 {
 // FunctionNames returns a map with the keys set to the names of the functions present in the expression.
 func (e *Expression) FunctionNames() map[string]struct{} {
 	names := map[string]struct{}{}
-	for _, t := range e.shunted {
-		if t.kind == tokenFunction {
-			if n, ok := t.value.(string); ok {
-				names[n] = struct{}{}
-			}
+	Inspect(e.root, func(node Node) bool {
+		if c, ok := node.(*CallNode); ok {
+			names[c.Name] = struct{}{}
 		}
-	}
+		return true
+	})
 	return names
 }
@@ -1,6 +1,7 @@
 package expression
 
 import (
+	"errors"
 	"math"
 	"testing"
 )
@@ -34,7 +35,7 @@ func TestEvaluateFailNumberLetter(t *testing.T) {
 
 func TestEvaluateFailLetterNumber(t *testing.T) {
 
-	expression := "x2"
+	expression := "x.2"
 	_, err := EvalExpression(expression)
 	if err == nil {
 		t.Fatal("Expected an error but got nothing.")
@@ -280,3 +281,386 @@ func TestVariableGlobals(t *testing.T) {
 		}
 	}
 }
+
+func TestMultipleArgumentFunction(t *testing.T) {
+	expressionString := "max(a, 2*b, -3) + clamp(x, 0, 1) + five()"
+	expected := 6.0 + 1.0 + 5.0
+
+	expr, e := GetExpression(expressionString)
+	if e != nil {
+		t.Fatalf("Got unexpected error %s", e)
+	}
+
+	expr.SetVariadicFunctions(map[string]VariadicFunction{
+		"max": func(args ...float64) (float64, error) {
+			return math.Max(math.Max(args[0], args[1]), args[2]), nil
+		},
+		"clamp": func(args ...float64) (float64, error) {
+			return math.Min(math.Max(args[0], args[1]), args[2]), nil
+		},
+		"five": func(args ...float64) (float64, error) {
+			return 5, nil
+		},
+	})
+	expr.SetVariables(map[string]float64{
+		"a": 4,
+		"b": 3,
+		"x": 20,
+	})
+
+	result, err := expr.Eval()
+	if err != nil {
+		t.Fatalf("Unexpected Error\n%s", err)
+	}
+
+	if result != expected {
+		t.Fatalf("Unexpected answer, expected %f but got %f", expected, result)
+	}
+}
+
+func TestNestedMultipleArgumentFunction(t *testing.T) {
+	expressionString := "-arctan(sub(5, 2), -(1 + 2)) ^ 2"
+	expected := math.Pow(-math.Atan2(3, -3), 2)
+
+	expr, e := GetExpression(expressionString)
+	if e != nil {
+		t.Fatalf("Got unexpected error %s", e)
+	}
+
+	expr.SetVariadicFunctions(map[string]VariadicFunction{
+		"arctan": func(args ...float64) (float64, error) {
+			return math.Atan2(args[0], args[1]), nil
+		},
+		"sub": func(args ...float64) (float64, error) {
+			return args[0] - args[1], nil
+		},
+	})
+
+	result, err := expr.Eval()
+	if err != nil {
+		t.Fatalf("Unexpected Error\n%s", err)
+	}
+
+	if result != expected {
+		t.Fatalf("Unexpected answer, expected %f but got %f", expected, result)
+	}
+}
+
+func TestSingleArgumentFunctionArity(t *testing.T) {
+	expr, e := GetExpression("sin(1, 2)")
+	if e != nil {
+		t.Fatalf("Got unexpected error %s", e)
+	}
+
+	expr.SetFunctions(map[string]func(float64) float64{
+		"sin": math.Sin,
+	})
+
+	if _, err := expr.Eval(); err == nil {
+		t.Fatal("Expected an error but got nothing.")
+	}
+}
+
+func TestBadExpressionCommas(t *testing.T) {
+	for _, expression := range []string{"1, 2", "(1, 2)", "f(1,,2)", "f(,1)", "f(1,)"} {
+		_, err := GetExpression(expression)
+		if err == nil {
+			t.Errorf("Expected an error for %s but got nothing.", expression)
+		}
+	}
+}
+
+func TestPrefixBeforeBrackets(t *testing.T) {
+	// brackets after a prefix operator hold its operand rather than the arguments of a call
+	for _, expression := range []string{"-(1, 2)", "-()", "!()", "!(1, 2)"} {
+		_, err := GetExpression(expression)
+		if err == nil {
+			t.Errorf("Expected an error for %s but got nothing.", expression)
+		}
+	}
+
+	tests := []struct {
+		expression string
+		expected   float64
+	}{
+		{"-(1 + 2)", -3},
+		{"-(2)*3", -6},
+		{"--(1)", 1},
+		{"!(0)", 1},
+	}
+	for _, test := range tests {
+		result, err := EvalExpression(test.expression)
+		if err != nil {
+			t.Errorf("Unexpected error for %s\n%s", test.expression, err)
+		} else if result != test.expected {
+			t.Errorf("Unexpected answer for %s, expected %f but got %f", test.expression, test.expected, result)
+		}
+	}
+}
+
+func TestImplicitMultiplication(t *testing.T) {
+	tests := []struct {
+		expression string
+		expected   float64
+	}{
+		{"2x", 6},
+		{"3(a+b)", 18},
+		{"(a+b)(a-b)", -12},
+		{"2x^2", 18},
+		{"-x^2", 9},
+		{"(a)2", 4},
+		{"(a)b", 8},
+		{"1/2x", 1.5},
+		{"2double(x)", 12},
+		{"double(x)(a)", 12},
+		{"2e", 20},
+		{"2e3", 2000},
+		{"2e-1", 0.2},
+		{"2e-x", 17},
+		{"1.5a", 3},
+		{"3!x", 18},
+		{"(a)!(b)", 8},
+		{"x!a", 12},
+	}
+
+	for _, test := range tests {
+		expr, err := GetExpressionWithOptions(test.expression, ParseOptions{ImplicitMultiplication: true})
+		if err != nil {
+			t.Errorf("Unexpected error for %s\n%s", test.expression, err)
+			continue
+		}
+		expr.SetVariables(map[string]float64{"a": 2, "b": 4, "x": 3, "e": 10})
+		expr.SetFunctions(map[string]func(float64) float64{
+			"double": func(v float64) float64 {
+				return v * 2
+			},
+		})
+
+		result, err := expr.Eval()
+		if err != nil {
+			t.Errorf("Unexpected error evaluating %s\n%s", test.expression, err)
+		} else if math.Abs(result-test.expected) > 1e-12 {
+			t.Errorf("Unexpected answer for %s, expected %f but got %f", test.expression, test.expected, result)
+		}
+	}
+}
+
+func TestImplicitMultiplicationFunctionCall(t *testing.T) {
+	expr, err := GetExpressionWithOptions("a(b)", ParseOptions{ImplicitMultiplication: true})
+	if err != nil {
+		t.Fatalf("Unexpected Error\n%s", err)
+	}
+
+	if _, ok := expr.FunctionNames()["a"]; !ok || len(expr.FunctionNames()) != 1 {
+		t.Fatalf("Expected a to be called but got functions %v", expr.FunctionNames())
+	}
+	if _, ok := expr.VariableNames()["b"]; !ok || len(expr.VariableNames()) != 1 {
+		t.Fatalf("Expected only the variable b but got %v", expr.VariableNames())
+	}
+}
+
+func TestImplicitMultiplicationErrors(t *testing.T) {
+	for _, expression := range []string{"x.5", "2 x", "2x 3"} {
+		if _, err := GetExpressionWithOptions(expression, ParseOptions{ImplicitMultiplication: true}); err == nil {
+			t.Errorf("Expected an error for %s but got nothing.", expression)
+		}
+	}
+}
+
+func TestComparisonAndLogicalOperators(t *testing.T) {
+	tests := []struct {
+		expression string
+		expected   float64
+	}{
+		{"1 < 2", 1},
+		{"2 < 2", 0},
+		{"2 <= 2", 1},
+		{"3 > 2", 1},
+		{"2 >= 3", 0},
+		{"2 == 2", 1},
+		{"2 != 2", 0},
+		{"1 && 0", 0},
+		{"2 && -1", 1},
+		{"0 || 0", 0},
+		{"0 || 3", 1},
+		{"!0", 1},
+		{"!5", 0},
+		{"!-1", 0},
+		{"1 + 1 == 2", 1},
+		{"1 < 2 == 2 < 3", 1},
+		{"0 && 0 || 1", 1},
+		{"1 || 1 && 0", 1},
+		{"!0 + 1", 2},
+		{"!(0 + 1)", 0},
+		{"1 != 2 && 2 >= 2", 1},
+		{"if(1, 2, 3)", 2},
+		{"if(0, 2, 3)", 3},
+		{"if(-1 < 0, 0, 4) * 2", 0},
+		{"if(1 > 2, 1, if(2 > 3, 2, 3))", 3},
+	}
+
+	for _, test := range tests {
+		result, err := EvalExpression(test.expression)
+		if err != nil {
+			t.Errorf("Unexpected error for %s\n%s", test.expression, err)
+		} else if result != test.expected {
+			t.Errorf("Unexpected answer for %s, expected %f but got %f", test.expression, test.expected, result)
+		}
+	}
+}
+
+func TestConditionalPiecewise(t *testing.T) {
+	expr, err := GetExpression("if(x < 0, 0, k*x)")
+	if err != nil {
+		t.Fatalf("Unexpected Error\n%s", err)
+	}
+
+	for x, expected := range map[float64]float64{-2: 0, 0: 0, 3: 6} {
+		expr.SetVariables(map[string]float64{"x": x, "k": 2})
+		result, err := expr.Eval()
+		if err != nil {
+			t.Fatalf("Unexpected Error\n%s", err)
+		}
+		if result != expected {
+			t.Errorf("Unexpected answer for x = %f, expected %f but got %f", x, expected, result)
+		}
+	}
+}
+
+func TestConditionalShortCircuit(t *testing.T) {
+	for _, expression := range []string{"if(1, 2, fail())", "if(0, fail(), 2)", "0 && fail()", "1 || fail()"} {
+		expr, err := GetExpression(expression)
+		if err != nil {
+			t.Fatalf("Unexpected Error\n%s", err)
+		}
+
+		expr.SetVariadicFunctions(map[string]VariadicFunction{
+			"fail": func(args ...float64) (float64, error) {
+				return 0, errors.New("evaluated the branch that wasn't taken")
+			},
+		})
+
+		if _, err := expr.Eval(); err != nil {
+			t.Errorf("Unexpected error for %s\n%s", expression, err)
+		}
+	}
+}
+
+func TestBadLogicalExpressions(t *testing.T) {
+	for _, expression := range []string{"x = 1", "x & y", "x | y", "x!y", "if(1, 2)", "if(1, 2, 3, 4)", "1 <", "&& 1"} {
+		if _, err := GetExpression(expression); err == nil {
+			t.Errorf("Expected an error for %s but got nothing.", expression)
+		}
+	}
+}
+
+func TestModuloDivisionFactorial(t *testing.T) {
+	tests := []struct {
+		expression string
+		expected   float64
+	}{
+		{"7 % 3", 1},
+		{"-7 % 3", 2},
+		{"7 % -3", -2},
+		{"5.5 % 2", 1.5},
+		{"7 // 2", 3},
+		{"-7 // 2", -4},
+		{"7 // 2 * 2 + 7 % 2", 7},
+		{"2 * 7 % 4", 2},
+		{"1 + 7 // 2", 4},
+		{"0!", 1},
+		{"5!", 120},
+		{"3!!", 720},
+		{"2^3!", 64},
+		{"-3!", -6},
+		{"(1 + 2)! / 2", 3},
+		{"3! == 6", 1},
+		{"3!=6", 1},
+		{"!0!", 0},
+		{"0.5!", math.Sqrt(math.Pi) / 2},
+	}
+
+	for _, test := range tests {
+		result, err := EvalExpression(test.expression)
+		if err != nil {
+			t.Errorf("Unexpected error for %s\n%s", test.expression, err)
+		} else if math.Abs(result-test.expected) > 1e-12 {
+			t.Errorf("Unexpected answer for %s, expected %f but got %f", test.expression, test.expected, result)
+		}
+	}
+}
+
+func TestFactorialDeriveError(t *testing.T) {
+	expr, err := GetExpression("x!")
+	if err != nil {
+		t.Fatalf("Unexpected Error\n%s", err)
+	}
+	if _, err := expr.Derive("x"); err == nil {
+		t.Fatal("Expected an error but got nothing.")
+	}
+}
+
+func TestProgram(t *testing.T) {
+	expr, err := GetExpression("r = sqrt(x^2 + y^2); theta = atan(y/x); r*theta")
+	if err != nil {
+		t.Fatalf("Unexpected Error\n%s", err)
+	}
+	expr.UseStandardLibrary()
+
+	names := expr.VariableNames()
+	if _, ok := names["x"]; !ok || len(names) != 2 {
+		t.Fatalf("Expected only the variables x and y but got %v", names)
+	}
+	if _, ok := names["y"]; !ok {
+		t.Fatalf("Expected only the variables x and y but got %v", names)
+	}
+
+	expr.SetVariables(map[string]float64{"x": 3, "y": 4})
+	result, err := expr.Eval()
+	if err != nil {
+		t.Fatalf("Unexpected Error\n%s", err)
+	}
+
+	expected := 5 * math.Atan(4.0/3)
+	if math.Abs(result-expected) > 1e-12 {
+		t.Fatalf("Unexpected answer, expected %f but got %f", expected, result)
+	}
+}
+
+func TestProgramShadowing(t *testing.T) {
+	tests := []struct {
+		expression string
+		expected   float64
+	}{
+		{"a = 2; a*x", 6},
+		{"a = x + 1; a = a*2; a", 8},
+		{"x = x*2; x + 1", 7},
+		{"pi = 3; pi", 3},
+		{"b = if(x > 2, 1, 0); b + x", 4},
+		{"a = -1; -a", 1},
+	}
+
+	for _, test := range tests {
+		expr, err := GetExpression(test.expression)
+		if err != nil {
+			t.Fatalf("Unexpected error for %s\n%s", test.expression, err)
+		}
+		expr.SetGlobals(map[string]float64{"pi": math.Pi})
+		expr.SetVariables(map[string]float64{"x": 3})
+
+		result, err := expr.Eval()
+		if err != nil {
+			t.Errorf("Unexpected error for %s\n%s", test.expression, err)
+		} else if result != test.expected {
+			t.Errorf("Unexpected answer for %s, expected %f but got %f", test.expression, test.expected, result)
+		}
+	}
+}
+
+func TestBadPrograms(t *testing.T) {
+	for _, expression := range []string{"", "a = 1", "a = 1;", ";", "1; 2", "2 = 3", "a = b = 2; a", "(a = 1); a", "a =; a", "a == 1; a"} {
+		if _, err := GetExpression(expression); err == nil {
+			t.Errorf("Expected an error for %s but got nothing.", expression)
+		}
+	}
+}
@@ -0,0 +1,395 @@
+package expression
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Function is a function defined in the expression language, eg. f(x) = x^2 + 1.
+// Its body can only use its parameters and the globals of the expression calling it.
+type Function struct {
+	Name       string
+	Parameters []string
+	Body       Node
+}
+
+// ParseFunction parses the definition of a function written name(parameters) = body, where the body may be a program.
+// Functions can't be defined in the body.
+func ParseFunction(input string) (*Function, error) {
+
+	tokens, err := tokenizer(input, ParseOptions{}, &errorList{})
+	if err != nil {
+		return nil, err
+	}
+
+	f, index, err := parseHeader(tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	body, functions, err := parseProgram(tokens[index:], &errorList{})
+	if err != nil {
+		return nil, err
+	}
+	if len(functions) != 0 {
+		return nil, SyntaxError{
+			Description: "Functions can't be defined in the body of a function",
+			Position:    tokens[index].start,
+			End:         tokens[len(tokens)-1].end,
+		}
+	}
+	f.Body = body
+
+	return f, nil
+}
+
+// parseHeader parses the start of the definition of a function, name(parameters) =,
+// returning the function without its body and the index of the token the body starts at.
+func parseHeader(tokens []token) (*Function, int, error) {
+
+	if len(tokens) < 3 || tokens[0].kind != tokenFunction || !isSeparatorToken(tokens[1], '(') {
+		err := SyntaxError{
+			Description: "A function definition must start with the name of the function and its parameters in brackets",
+		}
+		if len(tokens) != 0 {
+			err.Position, err.End = tokens[0].start, tokens[0].end
+		}
+		return nil, 0, err
+	}
+	name, ok := tokens[0].value.(string)
+	if !ok {
+		return nil, 0, SyntaxError{
+			Description: "Cannot define a function with a reserved name",
+			Position:    tokens[0].start,
+			End:         tokens[0].end,
+		}
+	}
+
+	f := &Function{Name: name}
+
+	index := 2
+	closed := isSeparatorToken(tokens[index], ')')
+	if closed {
+		index++
+	}
+
+	// the parameters run to the end of the input without a closing bracket
+	unclosed := SyntaxError{
+		Description: "Missing ) after the parameters of the function",
+		Position:    tokens[len(tokens)-1].end,
+		End:         tokens[len(tokens)-1].end + 1,
+	}
+
+	for !closed {
+		if index >= len(tokens) {
+			return nil, 0, unclosed
+		}
+		if tokens[index].kind != tokenVariable {
+			return nil, 0, SyntaxError{
+				Description: "The parameters of a function must be names separated by commas",
+				Position:    tokens[index].start,
+				End:         tokens[index].end,
+			}
+		}
+
+		parameter := tokens[index].value.(string)
+		if indexOfName(f.Parameters, parameter) >= 0 {
+			return nil, 0, SyntaxError{
+				Description: fmt.Sprintf("Function %s has more than one parameter called %s", name, parameter),
+				Position:    tokens[index].start,
+				End:         tokens[index].end,
+			}
+		}
+		f.Parameters = append(f.Parameters, parameter)
+
+		if index+1 >= len(tokens) {
+			return nil, 0, unclosed
+		}
+		closed = isSeparatorToken(tokens[index+1], ')')
+		if !closed && !isSeparatorToken(tokens[index+1], ',') {
+			return nil, 0, SyntaxError{
+				Description: "The parameters of a function must be names separated by commas",
+				Position:    tokens[index+1].start,
+				End:         tokens[index+1].end,
+			}
+		}
+		index += 2
+	}
+
+	if index >= len(tokens) || tokens[index].kind != tokenOperator || tokens[index].value.(string) != "=" {
+		// shown just after the closing bracket of the parameters
+		end := tokens[index-1].end
+		return nil, 0, SyntaxError{
+			Description: "Missing = after the parameters of the function",
+			Position:    end,
+			End:         end + 1,
+		}
+	}
+
+	return f, index + 1, nil
+}
+
+// parseDefinition parses a statement of a program that defines a function, checking it against the functions defined before it.
+// The body of the function is the rest of the statement.
+func parseDefinition(statement []token, functions map[string]*Function) (*Function, error) {
+
+	f, index, err := parseHeader(statement)
+	if err != nil {
+		return nil, err
+	}
+	header := Span{Start: statement[0].start, End: statement[index-1].end}
+
+	if _, ok := functions[f.Name]; ok {
+		return nil, SyntaxError{
+			Description: fmt.Sprintf("Function %s is defined more than once", f.Name),
+			Position:    header.Start,
+			End:         header.End,
+		}
+	}
+
+	f.Body, err = parseStatement(statement[index:])
+	if err != nil {
+		return nil, err
+	}
+
+	defined := map[string]*Function{f.Name: f}
+	for name, g := range functions {
+		defined[name] = g
+	}
+	if err := checkRecursion(f, defined, nil, map[string]bool{}); err != nil {
+		return nil, withSpan(err, header)
+	}
+
+	return f, nil
+}
+
+// checkArity checks that the calls in the tree of the functions given have the right number of arguments.
+// When recovering from errors, the calls with the wrong number are replaced by NaN.
+func checkArity(node Node, functions map[string]*Function, errs *errorList) (Node, error) {
+	var err error
+	checked := Rewrite(node, func(n Node) Node {
+		c, ok := n.(*CallNode)
+		if !ok || err != nil {
+			return n
+		}
+		if f, ok := functions[c.Name]; ok && len(c.Args) != len(f.Parameters) {
+			err = errs.add(withSpan(arityError(f, len(c.Args)), c.Span).(SyntaxError))
+			return &NumberNode{Value: math.NaN(), Span: c.Span}
+		}
+		return n
+	})
+	return checked, err
+}
+
+// sortedNames returns the names of the functions in order.
+func sortedNames(functions map[string]*Function) []string {
+	var names []string
+	for name := range functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetDefinedFunctions sets the functions defined in the expression language that can be called by the expression.
+// A defined function takes priority over a function set with SetFunctions or SetVariadicFunctions of the same name.
+// Defined functions may call each other, but not recursively, which is checked here rather than every time they are called.
+// If any of them can call itself an error is returned and the defined functions are left unchanged.
+// The functions defined by the program of the expression are kept, and take priority over those given.
+func (e *Expression) SetDefinedFunctions(functions map[string]*Function) error {
+
+	merged := functions
+	if len(e.programFunctions) != 0 {
+		merged = map[string]*Function{}
+		for name, f := range functions {
+			merged[name] = f
+		}
+		for name, f := range e.programFunctions {
+			merged[name] = f
+		}
+	}
+
+	checked := map[string]bool{}
+	for _, name := range sortedNames(merged) {
+		if err := checkRecursion(merged[name], merged, nil, checked); err != nil {
+			return err
+		}
+	}
+
+	e.definedFunctions = merged
+	return nil
+}
+
+// Define parses the definition of a function, eg. f(x) = x^2 + 1, and adds it to the defined functions of the expression.
+// The map previously set by SetDefinedFunctions is not modified.
+// Like SetDefinedFunctions, an error is returned if the function could end up calling itself.
+func (e *Expression) Define(definition string) error {
+
+	f, err := ParseFunction(definition)
+	if err != nil {
+		return err
+	}
+
+	functions := map[string]*Function{f.Name: f}
+	for name, defined := range e.definedFunctions {
+		if name != f.Name {
+			functions[name] = defined
+		}
+	}
+	return e.SetDefinedFunctions(functions)
+}
+
+// call evaluates the defined function with the arguments, s is the scope of the caller.
+func (e *Expression) call(f *Function, args []float64, s *scope) (float64, error) {
+
+	if len(args) != len(f.Parameters) {
+		return 0.0, arityError(f, len(args))
+	}
+
+	inner := &scope{definition: f.Name, parent: s}
+	for i, parameter := range f.Parameters {
+		inner = &scope{name: parameter, value: args[i], parent: inner}
+	}
+
+	v, err := e.evaluate(f.Body, inner)
+	return v, inFunction(err, f.Name)
+}
+
+// inline replaces the calls of defined functions in the tree with their bodies, assigning the arguments to the parameters.
+// The parameters are renamed to the name of the function followed by the name of the parameter, eg. fx, or followed by a number
+// if that is taken, eg. fx1, so they can't hide the names used by the arguments, and the globals used by the body are replaced by their values.
+// Calling is the names of the functions whose bodies are being inlined, and taken is the names that can't be used for parameters,
+// which the new names are added to.
+func (e *Expression) inline(node Node, calling []string, taken map[string]bool) (Node, error) {
+
+	if len(e.definedFunctions) == 0 {
+		return node, nil
+	}
+
+	var err error
+	root := Rewrite(node, func(n Node) Node {
+		c, ok := n.(*CallNode)
+		if !ok || err != nil {
+			return n
+		}
+		f, ok := e.definedFunctions[c.Name]
+		if !ok {
+			return n
+		}
+
+		if len(c.Args) != len(f.Parameters) {
+			err = withSpan(arityError(f, len(c.Args)), c.Span)
+			return n
+		}
+		if indexOfName(calling, f.Name) >= 0 {
+			err = withSpan(recursionError(f.Name), c.Span)
+			return n
+		}
+
+		for name := range usedNames(f.Body) {
+			taken[name] = true
+		}
+		body, bodyErr := e.inline(f.Body, append(append([]string{}, calling...), f.Name), taken)
+		if bodyErr != nil {
+			err = withSpan(inFunction(bodyErr, f.Name), c.Span)
+			return n
+		}
+
+		renamed := make([]string, len(f.Parameters))
+		for i, parameter := range f.Parameters {
+			renamed[i] = freshName(f.Name+parameter, taken)
+		}
+
+		body = rewriteFree(body, func(v *VariableNode) Node {
+			if i := indexOfName(f.Parameters, v.Name); i >= 0 {
+				return &VariableNode{Name: renamed[i]}
+			}
+			if value, ok := e.globVariables[v.Name]; ok {
+				return number(value)
+			}
+			if err == nil {
+				err = SyntaxError{
+					Description: fmt.Sprintf("Variable with name %s is not a parameter, in function %s", v.Name, f.Name),
+					Position:    c.Span.Start,
+					End:         c.Span.End,
+				}
+			}
+			return v
+		})
+
+		for i := len(f.Parameters) - 1; i >= 0; i-- {
+			body = &AssignNode{
+				Name:  renamed[i],
+				Value: c.Args[i],
+				Body:  body,
+			}
+		}
+		return body
+	})
+
+	return root, err
+}
+
+// checkRecursion checks that the function can't end up calling itself, calling is the names of the functions that call it.
+// Checked is the names of the functions already known not to, so each function's body is only walked once.
+func checkRecursion(f *Function, functions map[string]*Function, calling []string, checked map[string]bool) error {
+
+	if indexOfName(calling, f.Name) >= 0 {
+		return recursionError(f.Name)
+	}
+	if checked[f.Name] {
+		return nil
+	}
+	calling = append(append([]string{}, calling...), f.Name)
+
+	var err error
+	Inspect(f.Body, func(n Node) bool {
+		if c, ok := n.(*CallNode); ok && err == nil {
+			if g, ok := functions[c.Name]; ok {
+				err = checkRecursion(g, functions, calling, checked)
+			}
+		}
+		return err == nil
+	})
+	if err == nil {
+		checked[f.Name] = true
+	}
+	return err
+}
+
+// inFunction describes an error from the body of a defined function.
+// Positions in the body are in the definition of the function rather than the input, so they are removed for the call to be used instead.
+func inFunction(err error, name string) error {
+	if syntaxError, ok := err.(SyntaxError); ok {
+		return SyntaxError{
+			Description: fmt.Sprintf("%s, in function %s", syntaxError.Description, name),
+		}
+	}
+	return err
+}
+
+func arityError(f *Function, arguments int) error {
+	return SyntaxError{
+		Description: fmt.Sprintf("Function with name %s takes %d parameters but got %d", f.Name, len(f.Parameters), arguments),
+	}
+}
+
+func recursionError(name string) error {
+	return SyntaxError{
+		Description: fmt.Sprintf("Function %s calls itself, recursion is not allowed", name),
+	}
+}
+
+func isSeparatorToken(t token, separator rune) bool {
+	return t.kind == tokenSeparator && t.value.(rune) == separator
+}
+
+func indexOfName(names []string, name string) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
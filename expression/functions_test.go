@@ -0,0 +1,295 @@
+package expression
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseFunction(t *testing.T) {
+	f, err := ParseFunction("hyp(a, b) = sqrt(a^2 + b^2)")
+	if err != nil {
+		t.Fatalf("Unexpected Error\n%s", err)
+	}
+
+	if f.Name != "hyp" || len(f.Parameters) != 2 || f.Parameters[0] != "a" || f.Parameters[1] != "b" {
+		t.Fatalf("Unexpected function %s with parameters %v", f.Name, f.Parameters)
+	}
+	if _, ok := f.Body.(*CallNode); !ok {
+		t.Fatalf("Expected the body to be a call of sqrt but got %T", f.Body)
+	}
+}
+
+func TestDefinedFunctions(t *testing.T) {
+	definitions := []string{
+		"f(x) = x^2 + 1",
+		"area(w, h) = w*h",
+		"two() = 2",
+		"circle(r) = pi*r^2",
+		"g(x) = s = sin(x); s*f(s)",
+		"sin(x) = 0",
+	}
+
+	tests := []struct {
+		expression string
+		expected   float64
+	}{
+		{"f(3) + f(x)", 15},
+		{"area(x, 3) + two()", 8},
+		{"area(3, x)", 6},
+		{"circle(x)", 4 * math.Pi},
+		{"f(f(x))", 26},
+		{"g(x)", 0},
+		{"x = 3; f(x)", 10},
+		{"w = 5; area(w, x)", 10},
+	}
+
+	for _, test := range tests {
+		expr, err := GetExpression(test.expression)
+		if err != nil {
+			t.Fatalf("Problem setting up expression, %s", err)
+		}
+		expr.UseStandardLibrary()
+		for _, definition := range definitions {
+			if err := expr.Define(definition); err != nil {
+				t.Fatalf("Problem defining %s, %s", definition, err)
+			}
+		}
+		variables := map[string]float64{"x": 2}
+		expr.SetVariables(variables)
+
+		result, err := expr.Eval()
+		if err != nil {
+			t.Errorf("Unexpected error for %s\n%s", test.expression, err)
+		} else if math.Abs(result-test.expected) > 1e-12 {
+			t.Errorf("Unexpected answer for %s, expected %f but got %f", test.expression, test.expected, result)
+		}
+
+		compiled, err := expr.Compile()
+		if err != nil {
+			t.Fatalf("Compile of %s failed, %s", test.expression, err)
+		}
+		result, err = compiled.Eval(compiled.Values(variables))
+		if err != nil {
+			t.Errorf("Unexpected error for compiled %s\n%s", test.expression, err)
+		} else if math.Abs(result-test.expected) > 1e-12 {
+			t.Errorf("Unexpected answer for compiled %s, expected %f but got %f", test.expression, test.expected, result)
+		}
+	}
+}
+
+func TestDeriveDefinedFunction(t *testing.T) {
+	expr, err := GetExpression("f(x^2, y) + f(y, x)")
+	if err != nil {
+		t.Fatalf("Problem setting up expression, %s", err)
+	}
+	if err := expr.Define("f(x, y) = x*y^2"); err != nil {
+		t.Fatalf("Problem defining f, %s", err)
+	}
+	expr.SetVariables(map[string]float64{"x": 1.5, "y": 0.5})
+
+	derived, err := expr.Derive("x")
+	if err != nil {
+		t.Fatalf("Derive failed, %s", err)
+	}
+	result, err := derived.Eval()
+	if err != nil {
+		t.Fatalf("Evaluating derivative failed, %s", err)
+	}
+
+	// d/dx (x^2 y^2 + y x^2) = 2x y^2 + 2xy
+	expected := 2*1.5*0.25 + 2*1.5*0.5
+	if math.Abs(result-expected) > 1e-12 {
+		t.Fatalf("Derivative incorrect, expected %f but got %f", expected, result)
+	}
+
+	if names := derived.VariableNames(); len(names) != 2 {
+		t.Fatalf("Expected only the variables x and y but got %v", names)
+	}
+}
+
+func TestDefinedFunctionErrors(t *testing.T) {
+	tests := []struct {
+		expression  string
+		definitions []string
+	}{
+		{"f(1, 2)", []string{"f(x) = x"}},
+		{"f()", []string{"f(x) = x"}},
+		{"f(1)", []string{"f(x) = x*k"}},
+	}
+
+	for _, test := range tests {
+		expr, err := GetExpression(test.expression)
+		if err != nil {
+			t.Fatalf("Problem setting up expression, %s", err)
+		}
+		for _, definition := range test.definitions {
+			if err := expr.Define(definition); err != nil {
+				t.Fatalf("Problem defining %s, %s", definition, err)
+			}
+		}
+		expr.SetVariables(map[string]float64{"k": 1, "x": 1})
+
+		if _, err := expr.Eval(); err == nil {
+			t.Errorf("Expected an error evaluating %s but got nothing.", test.expression)
+		} else if _, ok := err.(SyntaxError); !ok {
+			t.Errorf("Expected a SyntaxError evaluating %s but got %T", test.expression, err)
+		}
+		if _, err := expr.Compile(); err == nil {
+			t.Errorf("Expected an error compiling %s but got nothing.", test.expression)
+		}
+		if _, err := expr.Derive("x"); err == nil {
+			t.Errorf("Expected an error deriving %s but got nothing.", test.expression)
+		}
+	}
+}
+
+func TestDefineRecursion(t *testing.T) {
+	tests := [][]string{
+		{"f(n) = if(n < 1, 1, n*f(n - 1))"},
+		{"f(x) = g(x)", "g(x) = if(x > 2, f(x), x)"},
+		{"f(x) = g(x) + h(x)", "h(x) = 2*x", "g(x) = h(f(x))"},
+	}
+
+	for _, definitions := range tests {
+		expr, err := GetExpression("f(1)")
+		if err != nil {
+			t.Fatalf("Problem setting up expression, %s", err)
+		}
+
+		// the recursion is found by the last definition, which isn't added
+		last := len(definitions) - 1
+		for _, definition := range definitions[:last] {
+			if err := expr.Define(definition); err != nil {
+				t.Fatalf("Problem defining %s, %s", definition, err)
+			}
+		}
+		if err := expr.Define(definitions[last]); err == nil {
+			t.Errorf("Expected an error defining %v but got nothing.", definitions)
+		} else if _, ok := err.(SyntaxError); !ok {
+			t.Errorf("Expected a SyntaxError defining %v but got %T", definitions, err)
+		}
+	}
+
+	expr, err := GetExpression("f(1)")
+	if err != nil {
+		t.Fatalf("Problem setting up expression, %s", err)
+	}
+	err = expr.SetDefinedFunctions(map[string]*Function{
+		"f": {Name: "f", Parameters: []string{"x"}, Body: &CallNode{Name: "g", Args: []Node{&VariableNode{Name: "x"}}}},
+		"g": {Name: "g", Parameters: []string{"x"}, Body: &CallNode{Name: "f", Args: []Node{&VariableNode{Name: "x"}}}},
+	})
+	if err == nil {
+		t.Errorf("Expected an error setting functions that call each other but got nothing.")
+	}
+	if _, err := expr.Eval(); err == nil {
+		t.Errorf("Expected the recursive functions not to be set.")
+	}
+}
+
+func TestBadFunctionDefinitions(t *testing.T) {
+	for _, definition := range []string{"f = 1", "f(1) = 2", "f(x, x) = x", "f(x) x", "f(x,) = 1", "f(x y) = 1", "if(x) = 1", "f(x) = ", "f(x) == x", "(x) = 1", "f(", "f(x,", "f(x", "f(x)", "f(x y"} {
+		if _, err := ParseFunction(definition); err == nil {
+			t.Errorf("Expected an error for %s but got nothing.", definition)
+		}
+	}
+}
+
+func TestTruncatedFunctionDefinition(t *testing.T) {
+	for _, definition := range []string{"f(x,", "f(x", "f(x, y"} {
+		_, err := ParseFunction(definition)
+		syntaxError, ok := err.(SyntaxError)
+		if !ok {
+			t.Errorf("Expected a SyntaxError for %s but got %v", definition, err)
+			continue
+		}
+		if syntaxError.Position != len(definition) {
+			t.Errorf("Expected the error for %s at the end of the input but got position %d", definition, syntaxError.Position)
+		}
+	}
+}
+
+func TestProgramFunctions(t *testing.T) {
+	tests := []struct {
+		expression string
+		expected   float64
+	}{
+		{"f(x) = x^2; f(3)", 9},
+		{"f(x) = x^2 + 1; g(x, y) = f(x)*y; g(2, 3)", 15},
+		{"a = 3; f(x) = 2*x; f(a) + a", 9},
+		{"y = f(x); f(x) = x + 1; y", 3},
+		{"f(t) = sin(t)^2 + cos(t)^2; f(x)", 1},
+		{"two() = 2; two()*x", 4},
+	}
+
+	for _, test := range tests {
+		expr, err := GetExpression(test.expression)
+		if err != nil {
+			t.Fatalf("Problem setting up expression %s, %s", test.expression, err)
+		}
+		expr.UseStandardLibrary()
+		// functions set afterwards don't replace those of the program
+		if err := expr.SetDefinedFunctions(map[string]*Function{"f": {Name: "f", Body: number(0)}}); err != nil {
+			t.Fatalf("Problem setting defined functions for %s, %s", test.expression, err)
+		}
+		variables := map[string]float64{"x": 2}
+		expr.SetVariables(variables)
+
+		result, err := expr.Eval()
+		if err != nil {
+			t.Errorf("Unexpected error for %s\n%s", test.expression, err)
+		} else if math.Abs(result-test.expected) > 1e-12 {
+			t.Errorf("Unexpected answer for %s, expected %f but got %f", test.expression, test.expected, result)
+		}
+
+		compiled, err := expr.Compile()
+		if err != nil {
+			t.Fatalf("Compile of %s failed, %s", test.expression, err)
+		}
+		result, err = compiled.Eval(compiled.Values(variables))
+		if err != nil {
+			t.Errorf("Unexpected error for compiled %s\n%s", test.expression, err)
+		} else if math.Abs(result-test.expected) > 1e-12 {
+			t.Errorf("Unexpected answer for compiled %s, expected %f but got %f", test.expression, test.expected, result)
+		}
+
+		printed, err := GetExpression(expr.String())
+		if err != nil {
+			t.Errorf("Expected %s to parse back but got %s", expr.String(), err)
+		} else if printed.String() != expr.String() {
+			t.Errorf("Expected %s to parse back to the same expression but got %s", expr.String(), printed.String())
+		}
+	}
+}
+
+func TestProgramFunctionErrors(t *testing.T) {
+	// errors in definitions are found when parsing, rather than when calling or compiling
+	tests := map[string]int{
+		"f(x) = f(x); 1":                  0,
+		"f(x) = g(x); g(x) = f(x - 1); 1": 13,
+		"f(x) = x; f(1, 2)":               10,
+		"f(x, y) = x; g(x) = f(x); 1":     20,
+		"f(x) = x; f(y) = 2; 1":           10,
+		"f(x) = x^2":                      0,
+		"f(1) = 2; 1":                     2,
+		"f(x) = ; 1":                      0,
+		"f(x) = a = 1; 1":                 9,
+		"g(x) = x; 3*f(x) = 2; g(1)":      10,
+		"if(x) = 1; 1":                    0,
+	}
+
+	for expression, position := range tests {
+		_, err := GetExpression(expression)
+		syntaxError, ok := err.(SyntaxError)
+		if !ok {
+			t.Errorf("Expected a SyntaxError for %s but got %v", expression, err)
+			continue
+		}
+		if syntaxError.Position != position {
+			t.Errorf("Expected the error for %s in position %d but got %d, %s", expression, position, syntaxError.Position, err)
+		}
+	}
+
+	if _, err := ParseFunction("g(x) = f(y) = y; f(x)"); err == nil {
+		t.Errorf("Expected an error defining a function in the body of a function but got nothing.")
+	}
+}
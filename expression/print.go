@@ -0,0 +1,314 @@
+package expression
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// the precedence of the parts of an expression other than binary operators, whose precedence is given by operatorPrecedence.
+const (
+	assignPrecedence  = 0
+	unaryPrecedence   = 8
+	postfixPrecedence = 9
+	atomPrecedence    = 10
+)
+
+// String writes the expression as infix text with only the brackets it needs, eg. a + b * (c - d) or -x^2 for (-x)^2.
+// The functions defined by its program are written first.
+// The text parses back to an equivalent expression with the default ParseOptions.
+func (e *Expression) String() string {
+	return printer{}.program(e)
+}
+
+// Parenthesised writes the expression as infix text with every operation in brackets, eg. (a + (b * (c - d))).
+func (e *Expression) Parenthesised() string {
+	return printer{parenthesised: true}.program(e)
+}
+
+// LaTeX writes the expression as LaTeX maths, eg. \frac{a}{b} + \sqrt{x}.
+func (e *Expression) LaTeX() string {
+	return printer{latex: true}.program(e)
+}
+
+// Format writes the syntax tree as infix text with only the brackets it needs.
+// NaN and infinities are written as 0 / 0 and 1 / 0, which evaluate to them.
+// Assignments inside other operations, which come from inlining defined functions, are written in brackets
+// but can't be parsed.
+func Format(node Node) string {
+	return printer{}.print(node)
+}
+
+// FormatParenthesised writes the syntax tree as infix text with every operation in brackets.
+func FormatParenthesised(node Node) string {
+	return printer{parenthesised: true}.print(node)
+}
+
+// FormatLaTeX writes the syntax tree as LaTeX maths.
+// Divisions are written as fractions, so they only need brackets as the base of a power or the operand of a factorial.
+func FormatLaTeX(node Node) string {
+	return printer{latex: true}.print(node)
+}
+
+// printer writes syntax trees as text.
+type printer struct {
+	// parenthesised puts every operation in brackets.
+	parenthesised bool
+	latex         bool
+}
+
+// program writes the functions defined by the program of the expression, in order of their names, followed by its tree.
+func (p printer) program(e *Expression) string {
+
+	separator := "; "
+	if p.latex {
+		separator = `; \quad `
+	}
+
+	var text strings.Builder
+	for _, name := range sortedNames(e.programFunctions) {
+		f := e.programFunctions[name]
+		parameters := make([]Node, len(f.Parameters))
+		for i, parameter := range f.Parameters {
+			parameters[i] = &VariableNode{Name: parameter}
+		}
+		header, _ := p.call(&CallNode{Name: f.Name, Args: parameters})
+		text.WriteString(header + " = " + p.operand(f.Body, assignPrecedence+1) + separator)
+	}
+	text.WriteString(p.print(e.root))
+
+	return text.String()
+}
+
+func (p printer) print(node Node) string {
+	if node == nil {
+		return ""
+	}
+	text, _ := p.write(node)
+	return text
+}
+
+// write returns the text of the node and the precedence of its outermost operation, which decides if it needs brackets.
+func (p printer) write(node Node) (string, int) {
+	switch n := node.(type) {
+	case *NumberNode:
+		return p.number(n.Value)
+
+	case *VariableNode:
+		if p.latex {
+			return latexName(n.Name), atomPrecedence
+		}
+		return n.Name, atomPrecedence
+
+	case *UnaryNode:
+		operator := n.Operator
+		if p.latex && operator == "!" {
+			operator = `\lnot `
+		}
+		return p.group(operator+p.operand(n.Operand, unaryPrecedence), unaryPrecedence)
+
+	case *PostfixNode:
+		return p.group(p.operand(n.Operand, postfixPrecedence)+n.Operator, postfixPrecedence)
+
+	case *BinaryNode:
+		return p.binary(n)
+
+	case *ConditionalNode:
+		condition := p.operand(n.Condition, assignPrecedence+1)
+		then := p.operand(n.Then, assignPrecedence+1)
+		otherwise := p.operand(n.Else, assignPrecedence+1)
+		if p.latex {
+			return `\begin{cases} ` + then + ` & \text{if } ` + condition + ` \\ ` + otherwise + ` & \text{otherwise} \end{cases}`, atomPrecedence
+		}
+		return "if(" + condition + ", " + then + ", " + otherwise + ")", atomPrecedence
+
+	case *AssignNode:
+		name := n.Name
+		separator := "; "
+		if p.latex {
+			name = latexName(name)
+			separator = `; \quad `
+		}
+		return name + " = " + p.operand(n.Value, assignPrecedence+1) + separator + p.print(n.Body), assignPrecedence
+
+	case *CallNode:
+		return p.call(n)
+	}
+	panic("The node is not a valid node, this should never happen")
+}
+
+// operand writes a node that must have at least the precedence given, putting it in brackets if it doesn't.
+func (p printer) operand(node Node, precedence int) string {
+	text, own := p.write(node)
+	if own < precedence {
+		return p.brackets(text)
+	}
+	return text
+}
+
+// group returns an operation with its precedence, or in brackets if every operation is parenthesised.
+func (p printer) group(text string, precedence int) (string, int) {
+	if p.parenthesised {
+		return p.brackets(text), atomPrecedence
+	}
+	return text, precedence
+}
+
+func (p printer) brackets(text string) string {
+	if p.latex {
+		return `\left(` + text + `\right)`
+	}
+	return "(" + text + ")"
+}
+
+func (p printer) number(value float64) (string, int) {
+	switch {
+	case math.IsNaN(value) && p.latex:
+		return `\mathrm{NaN}`, atomPrecedence
+	case math.IsInf(value, 0) && p.latex:
+		if value < 0 {
+			return p.group(`-\infty`, unaryPrecedence)
+		}
+		return `\infty`, atomPrecedence
+	case math.IsNaN(value):
+		return p.group("0 / 0", operatorPrecedence("/"))
+	case math.IsInf(value, 1):
+		return p.group("1 / 0", operatorPrecedence("/"))
+	case math.IsInf(value, -1):
+		return p.group("-1 / 0", operatorPrecedence("/"))
+	}
+
+	text := strconv.FormatFloat(math.Abs(value), 'g', -1, 64)
+	precedence := atomPrecedence
+	if i := strings.IndexByte(text, 'e'); i >= 0 && p.latex {
+		exponent, _ := strconv.Atoi(text[i+1:])
+		text = text[:i] + ` \times 10^{` + strconv.Itoa(exponent) + `}`
+		// like a fraction, it only needs brackets as the base of a power or the operand of a factorial
+		precedence = unaryPrecedence
+	}
+
+	if math.Signbit(value) {
+		if precedence < unaryPrecedence {
+			text = p.brackets(text)
+		}
+		return p.group("-"+text, unaryPrecedence)
+	}
+	if precedence != atomPrecedence {
+		return p.group(text, precedence)
+	}
+	return text, precedence
+}
+
+func (p printer) binary(n *BinaryNode) (string, int) {
+	precedence := operatorPrecedence(n.Operator)
+
+	if p.latex {
+		switch n.Operator {
+		case "/":
+			fraction := `\frac{` + p.operand(n.Left, assignPrecedence+1) + `}{` + p.operand(n.Right, assignPrecedence+1) + `}`
+			return p.group(fraction, unaryPrecedence)
+		case "//":
+			fraction := `\frac{` + p.operand(n.Left, assignPrecedence+1) + `}{` + p.operand(n.Right, assignPrecedence+1) + `}`
+			return `\left\lfloor ` + fraction + ` \right\rfloor`, atomPrecedence
+		case "^":
+			// a base that isn't a single value is always bracketed, as -x^2 is read as -(x^2) in maths
+			power := p.operand(n.Left, atomPrecedence) + `^{` + p.operand(n.Right, assignPrecedence+1) + `}`
+			return p.group(power, precedence)
+		}
+	}
+
+	// every binary operator is left associative, so an operand on the right with the same precedence needs brackets
+	left := p.operand(n.Left, precedence)
+	right := p.operand(n.Right, precedence+1)
+
+	operator := " " + n.Operator + " "
+	if p.latex {
+		operator = " " + latexOperators[n.Operator] + " "
+	} else if n.Operator == "^" {
+		operator = "^"
+	}
+	return p.group(left+operator+right, precedence)
+}
+
+func (p printer) call(n *CallNode) (string, int) {
+	args := make([]string, len(n.Args))
+	for i, arg := range n.Args {
+		args[i] = p.operand(arg, assignPrecedence+1)
+	}
+	list := strings.Join(args, ", ")
+
+	if !p.latex {
+		return n.Name + "(" + list + ")", atomPrecedence
+	}
+
+	if len(args) == 1 {
+		switch n.Name {
+		case "sqrt":
+			return `\sqrt{` + list + `}`, atomPrecedence
+		case "abs":
+			return `\left| ` + list + ` \right|`, atomPrecedence
+		case "floor":
+			return `\left\lfloor ` + list + ` \right\rfloor`, atomPrecedence
+		case "ceil":
+			return `\left\lceil ` + list + ` \right\rceil`, atomPrecedence
+		}
+	}
+
+	name, ok := latexFunctions[n.Name]
+	if !ok {
+		name = `\operatorname{` + n.Name + `}`
+	}
+	return name + `\left(` + list + `\right)`, atomPrecedence
+}
+
+// latexName writes the name of a variable, in italics if it is a single letter and upright otherwise, with Greek letters written out.
+func latexName(name string) string {
+	if greekLetters[name] {
+		return `\` + name
+	}
+	if len([]rune(name)) == 1 {
+		return name
+	}
+	return `\mathrm{` + name + `}`
+}
+
+var latexOperators = map[string]string{
+	"+":  "+",
+	"-":  "-",
+	"*":  `\cdot`,
+	"%":  `\bmod`,
+	"<":  "<",
+	"<=": `\leq`,
+	">":  ">",
+	">=": `\geq`,
+	"==": "=",
+	"!=": `\neq`,
+	"&&": `\land`,
+	"||": `\lor`,
+}
+
+// the functions that LaTeX has commands for
+var latexFunctions = map[string]string{
+	"sin":   `\sin`,
+	"cos":   `\cos`,
+	"tan":   `\tan`,
+	"asin":  `\arcsin`,
+	"acos":  `\arccos`,
+	"atan":  `\arctan`,
+	"sinh":  `\sinh`,
+	"cosh":  `\cosh`,
+	"tanh":  `\tanh`,
+	"exp":   `\exp`,
+	"ln":    `\ln`,
+	"log":   `\log`,
+	"min":   `\min`,
+	"max":   `\max`,
+	"gamma": `\Gamma`,
+}
+
+var greekLetters = map[string]bool{
+	"alpha": true, "beta": true, "gamma": true, "delta": true, "epsilon": true, "zeta": true, "eta": true, "theta": true,
+	"iota": true, "kappa": true, "lambda": true, "mu": true, "nu": true, "xi": true, "pi": true, "rho": true,
+	"sigma": true, "tau": true, "upsilon": true, "phi": true, "chi": true, "psi": true, "omega": true,
+	"Gamma": true, "Delta": true, "Theta": true, "Lambda": true, "Xi": true, "Pi": true, "Sigma": true, "Phi": true, "Psi": true, "Omega": true,
+}
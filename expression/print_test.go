@@ -0,0 +1,111 @@
+package expression
+
+import (
+	"math"
+	"testing"
+)
+
+func TestString(t *testing.T) {
+	tests := map[string]string{
+		"a+b*(c-d)":           "a + b * (c - d)",
+		"(a+b)*c":             "(a + b) * c",
+		"a-(b-c)":             "a - (b - c)",
+		"(a-b)-c":             "a - b - c",
+		"a^b^c":               "a^b^c",
+		"a^(b^c)":             "a^(b^c)",
+		"-x^2":                "-x^2",
+		"-(x^2)":              "-(x^2)",
+		"-(a+b)":              "-(a + b)",
+		"a*-b":                "a * -b",
+		"(-x)!":               "(-x)!",
+		"-x!":                 "-x!",
+		"(a+b)!":              "(a + b)!",
+		"!(a&&b)||c":          "!(a && b) || c",
+		"a<b==(c>=d)":         "a < b == c >= d",
+		"(a==b)<c":            "(a == b) < c",
+		"a//b%c":              "a // b % c",
+		"if(x>0,x,-x)":        "if(x > 0, x, -x)",
+		"max((1),2,a+b)":      "max(1, 2, a + b)",
+		"r=x^2;s=r+1;(r*s)":   "r = x^2; s = r + 1; r * s",
+		"1.5e30+2.5e-7+0.125": "1.5e+30 + 2.5e-07 + 0.125",
+	}
+
+	for input, expected := range tests {
+		expr, err := GetExpression(input)
+		if err != nil {
+			t.Fatalf("Unexpected Error for %s\n%s", input, err)
+		}
+
+		if s := expr.String(); s != expected {
+			t.Errorf("Expected %s to print as %s but got %s", input, expected, s)
+		}
+	}
+}
+
+func TestStringBuiltTree(t *testing.T) {
+	tests := []struct {
+		node     Node
+		expected string
+	}{
+		{&BinaryNode{Operator: "*", Left: number(-2), Right: &VariableNode{Name: "x"}}, "-2 * x"},
+		{&BinaryNode{Operator: "^", Left: &VariableNode{Name: "x"}, Right: number(-1)}, "x^-1"},
+		{&PostfixNode{Operator: "!", Operand: number(-3)}, "(-3)!"},
+		{&BinaryNode{Operator: "+", Left: number(math.Inf(1)), Right: number(math.NaN())}, "1 / 0 + 0 / 0"},
+		{&BinaryNode{Operator: "*", Left: number(2), Right: &AssignNode{Name: "a", Value: number(1), Body: &VariableNode{Name: "a"}}}, "2 * (a = 1; a)"},
+	}
+
+	for _, test := range tests {
+		if s := Format(test.node); s != test.expected {
+			t.Errorf("Expected %s but got %s", test.expected, s)
+		}
+	}
+}
+
+func TestParenthesised(t *testing.T) {
+	tests := map[string]string{
+		"a+b*c":       "(a + (b * c))",
+		"-x^2":        "((-x)^2)",
+		"x!+f(y*2)":   "((x!) + f((y * 2)))",
+		"a=1+b;a*2":   "a = (1 + b); (a * 2)",
+		"if(a<b,1,2)": "if((a < b), 1, 2)",
+		"x":           "x",
+	}
+
+	for input, expected := range tests {
+		expr, err := GetExpression(input)
+		if err != nil {
+			t.Fatalf("Unexpected Error for %s\n%s", input, err)
+		}
+
+		if s := expr.Parenthesised(); s != expected {
+			t.Errorf("Expected %s to print as %s but got %s", input, expected, s)
+		}
+	}
+}
+
+func TestLaTeX(t *testing.T) {
+	tests := map[string]string{
+		"(a+b)/c":         `\frac{a + b}{c}`,
+		"(a/b)^2":         `\left(\frac{a}{b}\right)^{2}`,
+		"-x^2":            `\left(-x\right)^{2}`,
+		"x^(n+1)*theta":   `x^{n + 1} \cdot \theta`,
+		"sqrt(abs(x))":    `\sqrt{\left| x \right|}`,
+		"sin(x)+foo(x,y)": `\sin\left(x\right) + \operatorname{foo}\left(x, y\right)`,
+		"a<=b&&!c":        `a \leq b \land \lnot c`,
+		"a//b":            `\left\lfloor \frac{a}{b} \right\rfloor`,
+		"rate*6.02e23":    `\mathrm{rate} \cdot 6.02 \times 10^{23}`,
+		"if(x>0,x,0)":     `\begin{cases} x & \text{if } x > 0 \\ 0 & \text{otherwise} \end{cases}`,
+		"n!/k!":           `\frac{n!}{k!}`,
+	}
+
+	for input, expected := range tests {
+		expr, err := GetExpression(input)
+		if err != nil {
+			t.Fatalf("Unexpected Error for %s\n%s", input, err)
+		}
+
+		if s := expr.LaTeX(); s != expected {
+			t.Errorf("Expected %s to print as %s but got %s", input, expected, s)
+		}
+	}
+}
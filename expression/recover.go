@@ -0,0 +1,181 @@
+package expression
+
+import (
+	"math"
+)
+
+// repair fixes the structure of the tokens so every statement can be parsed, reporting each fix to errs.
+// Missing values are replaced by NaN, values next to each other are multiplied, missing closing brackets are added
+// and stray closing brackets, commas and equals signs are removed.
+func repair(tokens []token, errs *errorList) []token {
+
+	var repaired []token
+	// the index in repaired of the start of the current statement
+	statement := 0
+	// whether the next token must start a value, rather than being an operator or closing a value
+	expectValue := true
+	// the open brackets, and whether each holds the arguments of a function call
+	var open []token
+	var calls []bool
+
+	// fill adds NaN if a value is missing before next, which is nil at the end of a statement
+	fill := func(next *token) {
+		if !expectValue {
+			return
+		}
+
+		var previous *token
+		if len(repaired) > statement {
+			previous = &repaired[len(repaired)-1]
+		}
+		if previous == nil && next == nil {
+			// an empty statement is reported when the statement is parsed
+			return
+		}
+
+		err := SyntaxError{Description: "Operator is missing a value"}
+		at := next
+		switch {
+		case previous != nil && (previous.kind == tokenOperator || previous.kind == tokenFunction):
+			at = previous
+		case previous != nil && isSeparatorToken(*previous, ',') && calls[len(calls)-1]:
+			err.Description = "Missing function argument"
+		case previous != nil && isSeparatorToken(*previous, '(') && calls[len(calls)-1]:
+			if next == nil || isSeparatorToken(*next, ')') {
+				// a call without arguments
+				return
+			}
+			err.Description = "Missing function argument"
+		case previous != nil && isSeparatorToken(*previous, '('):
+			err.Description = "Empty brackets"
+		}
+		if at == nil {
+			at = previous
+		}
+		err.Position, err.End = at.start, at.end
+		errs.add(err)
+
+		var position int
+		if next != nil {
+			position = next.start
+		} else {
+			position = previous.end
+		}
+		repaired = append(repaired, token{
+			kind:  tokenNumber,
+			value: math.NaN(),
+			start: position,
+			end:   position,
+		})
+		expectValue = false
+	}
+
+	// closeStatement completes the statement ending at the position given
+	closeStatement := func(position int) {
+		fill(nil)
+		for i := len(open) - 1; i >= 0; i-- {
+			errs.add(SyntaxError{
+				Description: "Mismatched brackets",
+				Position:    open[i].start,
+				End:         open[i].end,
+			})
+			repaired = append(repaired, token{
+				kind:  tokenSeparator,
+				value: ')',
+				start: position,
+				end:   position,
+			})
+		}
+		open, calls = nil, nil
+	}
+
+	for _, t := range tokens {
+		switch {
+		case t.kind == tokenNumber || t.kind == tokenVariable || t.kind == tokenFunction || isSeparatorToken(t, '('):
+			if !expectValue {
+				// two values next to each other, which is only reported if nothing between them was
+				if !errs.reported(repaired[len(repaired)-1].end, t.start) {
+					errs.add(SyntaxError{
+						Description: "Missing operator",
+						Position:    t.start,
+						End:         t.end,
+					})
+				}
+				repaired = append(repaired, multiplyToken(t.start))
+			}
+
+			if isSeparatorToken(t, '(') {
+				call := len(repaired) != 0 && repaired[len(repaired)-1].kind == tokenFunction && !isPrefix(repaired[len(repaired)-1])
+				open = append(open, t)
+				calls = append(calls, call)
+			}
+			repaired = append(repaired, t)
+			expectValue = t.kind == tokenFunction || t.kind == tokenSeparator
+
+		case t.kind == tokenPostfix:
+			fill(&t)
+			repaired = append(repaired, t)
+
+		case t.kind == tokenOperator && t.value.(string) == "=":
+			// the = of a function definition directly follows the brackets of its parameters
+			header := repaired[statement:len(repaired):len(repaired)]
+			definition := isDefinition(append(header, t)) && !isDefinition(header)
+			if !definition && (len(repaired) != statement+1 || len(open) != 0) {
+				errs.add(SyntaxError{
+					Description: "Assignments must be at the start of a statement",
+					Position:    t.start,
+					End:         t.end,
+				})
+				continue
+			}
+			repaired = append(repaired, t)
+			expectValue = true
+
+		case t.kind == tokenOperator:
+			fill(&t)
+			repaired = append(repaired, t)
+			expectValue = true
+
+		case isSeparatorToken(t, ','):
+			if len(open) == 0 || !calls[len(calls)-1] {
+				errs.add(SyntaxError{
+					Description: "Comma outside of function call",
+					Position:    t.start,
+					End:         t.end,
+				})
+				continue
+			}
+			fill(&t)
+			repaired = append(repaired, t)
+			expectValue = true
+
+		case isSeparatorToken(t, ')'):
+			if len(open) == 0 {
+				errs.add(SyntaxError{
+					Description: "Mismatched brackets",
+					Position:    t.start,
+					End:         t.end,
+				})
+				continue
+			}
+			fill(&t)
+			open, calls = open[:len(open)-1], calls[:len(calls)-1]
+			repaired = append(repaired, t)
+			expectValue = false
+
+		case isSeparatorToken(t, ';'):
+			closeStatement(t.start)
+			repaired = append(repaired, t)
+			statement = len(repaired)
+			expectValue = true
+		}
+	}
+
+	end := 0
+	if len(tokens) != 0 {
+		end = tokens[len(tokens)-1].end
+	}
+	closeStatement(end)
+
+	return repaired
+}
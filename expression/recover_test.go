@@ -0,0 +1,95 @@
+package expression
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRecover(t *testing.T) {
+	tests := []struct {
+		expression string
+		// the positions of the errors found
+		positions []int
+		// the value of the partial expression, with x = 2
+		value float64
+	}{
+		{"1 + 2", nil, 3},
+		{"2 3 + x", []int{2}, 8},
+		{"x.5 + 2x", []int{1, 7}, 5},
+		{"2(3 + x", []int{1}, 10},
+		{"(1 + 2", []int{0}, 3},
+		{"1 + 2) * (x", []int{5, 9}, 5},
+		{"x & 0 || 0", []int{2}, 0},
+		{"x # 3 $", []int{2, 6}, 6},
+		{"1, x", []int{1}, 2},
+		{"max(1,,x)", []int{6}, math.NaN()},
+		{"1 + * 2", []int{2}, math.NaN()},
+		{"x = 1 = 2; x", []int{6}, 2},
+		{"a = 1; 2; a + x", []int{7}, 3},
+		{"a = x + 1", []int{0}, 3},
+		{"y = 1e + x; 3 = 4", []int{7, 9, 12}, 4},
+		{"f(y) = y^2; f(x) + 1", nil, 5},
+		{"f(y) = y^; f(x) = 1; f(x) + 1", []int{8, 11}, math.NaN()},
+		{"f(y) = y; f() + x", []int{10}, math.NaN()},
+	}
+
+	for _, test := range tests {
+		expr, err := GetExpressionWithOptions(test.expression, ParseOptions{Recover: true})
+
+		var errs SyntaxErrors
+		if err != nil {
+			var ok bool
+			if errs, ok = err.(SyntaxErrors); !ok {
+				t.Errorf("Expected SyntaxErrors for %s but got %T", test.expression, err)
+				continue
+			}
+		}
+
+		if len(errs) != len(test.positions) {
+			t.Errorf("Expected %d errors for %s but got %d\n%v", len(test.positions), test.expression, len(errs), err)
+			continue
+		}
+		for i, position := range test.positions {
+			if errs[i].Position != position {
+				t.Errorf("Expected error %d for %s to be in position %d but got %d", i, test.expression, position, errs[i].Position)
+			}
+		}
+
+		expr.SetVariables(map[string]float64{"x": 2})
+		expr.SetVariadicFunctions(StandardVariadicFunctions())
+		v, evalErr := expr.Eval()
+		if evalErr != nil {
+			t.Errorf("Unexpected error evaluating %s\n%s", test.expression, evalErr)
+			continue
+		}
+		if v != test.value && !(math.IsNaN(v) && math.IsNaN(test.value)) {
+			t.Errorf("Expected %s to be %f but got %f", test.expression, test.value, v)
+		}
+	}
+}
+
+func TestRecoverUnwrap(t *testing.T) {
+	_, err := GetExpressionWithOptions("(1 +", ParseOptions{Recover: true})
+	errs, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		t.Fatalf("Expected an error with Unwrap but got %T", err)
+	}
+
+	unwrapped := errs.Unwrap()
+	if len(unwrapped) != 2 {
+		t.Fatalf("Expected 2 errors but got %d", len(unwrapped))
+	}
+	for _, e := range unwrapped {
+		if _, ok := e.(SyntaxError); !ok {
+			t.Errorf("Expected a SyntaxError but got %T", e)
+		}
+	}
+}
+
+func TestRecoverOff(t *testing.T) {
+	// without recovering only the first error is returned
+	_, err := GetExpression("(1 + * 2")
+	if _, ok := err.(SyntaxError); !ok {
+		t.Errorf("Expected a single SyntaxError but got %T", err)
+	}
+}
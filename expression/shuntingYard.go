@@ -4,6 +4,8 @@ func shuntingYard(tokens []token) ([]token, error) {
 
 	var output []token
 	var operator []token
+	// the number of arguments seen so far for each open bracket, -1 if the bracket isn't a function call
+	var arguments []int
 
 	for index, t := range tokens {
 
@@ -14,7 +16,18 @@ func shuntingYard(tokens []token) ([]token, error) {
 			output = append(output, t)
 		case tokenFunction:
 			operator = append(operator, t)
+		case tokenPostfix:
+			// a postfix operator applies to the value just before it, so it binds tighter than anything else
+			output = append(output, t)
 		case tokenOperator:
+			if t.value.(string) == "=" {
+				return nil, SyntaxError{
+					Description: "Assignments must be at the start of a statement",
+					Position:    t.start,
+					End:         t.end,
+				}
+			}
+
 			for {
 				if len(operator) == 0 {
 					break
@@ -25,8 +38,8 @@ func shuntingYard(tokens []token) ([]token, error) {
 				op, equal := false, false
 
 				if topOperator.kind == tokenOperator {
-					op = operatorHasPrecedence(topOperator.value.(rune), t.value.(rune))
-					equal = operatorEqualPrecedence(topOperator.value.(rune), t.value.(rune))
+					op = operatorHasPrecedence(topOperator.value.(string), t.value.(string))
+					equal = operatorEqualPrecedence(topOperator.value.(string), t.value.(string))
 				}
 
 				left := topOperator.kind == tokenSeparator && topOperator.value.(rune) != '('
@@ -43,26 +56,85 @@ func shuntingYard(tokens []token) ([]token, error) {
 
 			operator = append(operator, t)
 		case tokenSeparator:
-			if t.value.(rune) == '(' {
+			separator := t.value.(rune)
+
+			if separator == '(' {
 				operator = append(operator, t)
-			} else {
-				for {
-					if len(operator) == 0 {
+
+				// brackets directly following a function hold its arguments
+				if index > 0 && tokens[index-1].kind == tokenFunction && !isPrefix(tokens[index-1]) {
+					if index+1 < len(tokens) && tokens[index+1].kind == tokenSeparator && tokens[index+1].value.(rune) == ')' {
+						arguments = append(arguments, 0)
+					} else {
+						arguments = append(arguments, 1)
+					}
+				} else {
+					arguments = append(arguments, -1)
+				}
+				continue
+			}
+
+			if index > 0 && tokens[index-1].kind == tokenSeparator {
+				previous := tokens[index-1].value.(rune)
+				emptyCall := separator == ')' && previous == '(' && len(arguments) != 0 && arguments[len(arguments)-1] == 0
+				if previous == ',' || (previous == '(' && !emptyCall) {
+					return nil, SyntaxError{
+						Description: "Missing function argument",
+						Position:    t.start,
+						End:         t.end,
+					}
+				}
+			}
+
+			for {
+				if len(operator) == 0 {
+					if separator == ',' {
 						return nil, SyntaxError{
-							Description: "Mismatched brackets",
-							Position:    index,
+							Description: "Comma outside of function call",
+							Position:    t.start,
+							End:         t.end,
 						}
 					}
+					return nil, SyntaxError{
+						Description: "Mismatched brackets",
+						Position:    t.start,
+						End:         t.end,
+					}
+				}
 
-					var to token
-					to, operator = operator[len(operator)-1], operator[:len(operator)-1]
+				top := operator[len(operator)-1]
+				if top.kind == tokenSeparator {
+					break
+				}
 
-					if to.kind == tokenSeparator {
-						break
-					}
-					output = append(output, to)
+				operator = operator[:len(operator)-1]
+				output = append(output, top)
+			}
 
+			if separator == ',' {
+				if arguments[len(arguments)-1] < 0 {
+					return nil, SyntaxError{
+						Description: "Comma outside of function call",
+						Position:    t.start,
+						End:         t.end,
+					}
 				}
+				arguments[len(arguments)-1]++
+				continue
+			}
+
+			// remove the opening bracket
+			operator = operator[:len(operator)-1]
+
+			var count int
+			count, arguments = arguments[len(arguments)-1], arguments[:len(arguments)-1]
+
+			if count >= 0 {
+				var fn token
+				fn, operator = operator[len(operator)-1], operator[:len(operator)-1]
+				fn.arity = count
+				fn.end = t.end
+				output = append(output, fn)
 			}
 
 		}
@@ -74,9 +146,11 @@ func shuntingYard(tokens []token) ([]token, error) {
 		to, operator = operator[len(operator)-1], operator[:len(operator)-1]
 
 		if to.kind == tokenSeparator {
+			// the bracket that was never closed
 			return nil, SyntaxError{
-				Description: "Mismatched brackets, guessing position",
-				Position:    len(output),
+				Description: "Mismatched brackets",
+				Position:    to.start,
+				End:         to.end,
 			}
 		}
 
@@ -87,36 +161,36 @@ func shuntingYard(tokens []token) ([]token, error) {
 
 }
 
-func operatorHasPrecedence(op1 rune, op2 rune) bool {
-
-	if op1 == '+' || op1 == '-' {
-		return false
-	}
-
-	if op1 == '*' || op1 == '/' {
-		return op2 == '+' || op2 == '-'
-	}
-
-	if op1 == '^' {
-		return op2 != '^'
-	}
-
-	panic("The operator was an unrecognised type, this is a bug in the tokenizer.")
+// isPrefix checks if the function token is a prefix operator, which is followed by its operand rather than arguments in brackets.
+func isPrefix(t token) bool {
+	return t.value == negateFunction || t.value == notFunction
 }
 
-func operatorEqualPrecedence(op1 rune, op2 rune) bool {
-
-	if op1 == '+' || op1 == '-' {
-		return op2 == '+' || op2 == '-'
-	}
+func operatorHasPrecedence(op1 string, op2 string) bool {
+	return operatorPrecedence(op1) > operatorPrecedence(op2)
+}
 
-	if op1 == '*' || op1 == '/' {
-		return op2 == '*' || op2 == '/'
-	}
+func operatorEqualPrecedence(op1 string, op2 string) bool {
+	return operatorPrecedence(op1) == operatorPrecedence(op2)
+}
 
-	if op1 == '^' {
-		return op2 == '^'
+// operatorPrecedence gives how tightly the operator binds, higher binds tighter.
+func operatorPrecedence(op string) int {
+	switch op {
+	case "||":
+		return 1
+	case "&&":
+		return 2
+	case "==", "!=":
+		return 3
+	case "<", "<=", ">", ">=":
+		return 4
+	case "+", "-":
+		return 5
+	case "*", "/", "%", "//":
+		return 6
+	case "^":
+		return 7
 	}
 	panic("The operator was an unrecognised type, this is a bug in the tokenizer.")
-
 }
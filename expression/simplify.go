@@ -0,0 +1,369 @@
+package expression
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Simplify returns a new Expression equivalent to this one, sharing its globals, functions and derivatives
+// with a copy of the values of its variables.
+// Constant parts are calculated, including calls of functions with constant arguments, and identities such as
+// x + 0, x*1, x*0, x^1, x^0 and --x are removed. Sums are collected into like terms, eg. 2*x + y + 3*x is 5*x + y,
+// and the numbers in products are multiplied together, eg. 2*x*3*x is 6*x^2.
+// Powers of the same base are only multiplied together if their exponents are whole numbers, so x^0.5*x^0.5 is left as it is.
+// Globals aren't replaced by their values, and parts that would calculate to NaN or an infinity are left as they are.
+// The result may differ slightly from the original through rounding, and x*0, 0/x and x/x are 0, 0 and 1
+// even where the variables of x make it 0, infinite or NaN, although not where x is a constant that is.
+func (e *Expression) Simplify() *Expression {
+	return e.withRoot(e.simplify(e.root))
+}
+
+func (e *Expression) simplify(node Node) Node {
+
+	switch n := node.(type) {
+	case *NumberNode, *VariableNode:
+		return n
+
+	case *UnaryNode:
+		operand := e.simplify(n.Operand)
+		if n.Operator == "-" {
+			return e.collect(&UnaryNode{Operator: n.Operator, Operand: operand})
+		}
+		return e.fold(&UnaryNode{Operator: n.Operator, Operand: operand})
+
+	case *PostfixNode:
+		return e.fold(&PostfixNode{Operator: n.Operator, Operand: e.simplify(n.Operand)})
+
+	case *BinaryNode:
+		left := e.simplify(n.Left)
+		right := e.simplify(n.Right)
+		simplified := &BinaryNode{Operator: n.Operator, Left: left, Right: right}
+
+		switch n.Operator {
+		case "+", "-", "*", "/":
+			if n.Operator == "/" && isValue(left, 0) && !isValue(right, 0) && !e.nonFinite(right) {
+				return number(0)
+			}
+			return e.collect(simplified)
+		case "^":
+			if isValue(left, 1) || isValue(right, 0) {
+				return number(1)
+			}
+			return e.collect(simplified)
+		case "&&", "||":
+			// the right is only evaluated if the left doesn't decide the result
+			if l, ok := left.(*NumberNode); ok && (l.Value != 0) == (n.Operator == "||") {
+				return number(truth(l.Value != 0))
+			}
+		}
+		return e.fold(simplified)
+
+	case *ConditionalNode:
+		condition := e.simplify(n.Condition)
+		if c, ok := condition.(*NumberNode); ok {
+			if c.Value != 0 {
+				return e.simplify(n.Then)
+			}
+			return e.simplify(n.Else)
+		}
+		return &ConditionalNode{Condition: condition, Then: e.simplify(n.Then), Else: e.simplify(n.Else)}
+
+	case *AssignNode:
+		value := e.simplify(n.Value)
+		body := n.Body
+		if _, ok := value.(*NumberNode); ok {
+			// a constant is put in place of the name, so it can be simplified with the rest of the body
+			body = rewriteFree(body, func(v *VariableNode) Node {
+				if v.Name == n.Name {
+					return value
+				}
+				return v
+			})
+		}
+		return assign(n.Name, value, e.simplify(body))
+
+	case *CallNode:
+		args := make([]Node, len(n.Args))
+		for i, arg := range n.Args {
+			args[i] = e.simplify(arg)
+		}
+		simplified := &CallNode{Name: n.Name, Args: args}
+
+		if _, defined := e.definedFunctions[n.Name]; defined {
+			return simplified
+		}
+		return e.fold(simplified)
+	}
+
+	panic("The node is not a valid node, this should never happen")
+}
+
+// fold calculates the node if its operands are all numbers, leaving it as it is if it can't or the result isn't finite.
+func (e *Expression) fold(node Node) Node {
+
+	if _, ok := node.(*VariableNode); ok {
+		return node
+	}
+
+	constant := true
+	Inspect(node, func(n Node) bool {
+		if n == nil || n == node {
+			return true
+		}
+		_, ok := n.(*NumberNode)
+		constant = constant && ok
+		return false
+	})
+	if !constant {
+		return node
+	}
+
+	v, err := e.evaluate(node, nil)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return node
+	}
+	return number(v)
+}
+
+// nonFinite checks if the node is a constant that calculates to NaN or an infinity, which fold leaves in place.
+func (e *Expression) nonFinite(node Node) bool {
+
+	constant := true
+	Inspect(node, func(n Node) bool {
+		switch n := n.(type) {
+		case *VariableNode, *AssignNode:
+			constant = false
+		case *CallNode:
+			if _, defined := e.definedFunctions[n.Name]; defined {
+				constant = false
+			}
+		}
+		return constant
+	})
+	if !constant {
+		return false
+	}
+
+	v, err := e.evaluate(node, nil)
+	return err == nil && (math.IsNaN(v) || math.IsInf(v, 0))
+}
+
+// anyNonFinite checks if any of the factors has a base that is a constant that calculates to NaN or an infinity.
+func (e *Expression) anyNonFinite(factors []factor) bool {
+	for _, f := range factors {
+		if e.nonFinite(f.base) {
+			return true
+		}
+	}
+	return false
+}
+
+// factor is a part of a product raised to a constant power.
+type factor struct {
+	base     Node
+	exponent float64
+}
+
+// term is a product of factors multiplied by a number.
+type term struct {
+	coefficient float64
+	factors     []factor
+}
+
+// collect simplifies a sum or product whose operands have already been simplified,
+// collecting like terms and multiplying together the numbers and the factors with the same base.
+func (e *Expression) collect(node Node) Node {
+
+	var terms []term
+	// the index of the term with each set of factors
+	index := map[string]int{}
+
+	for _, t := range splitTerms(node, 1) {
+		t.factors = e.combineFactors(t.factors)
+		key := factorsKey(t.factors)
+		if i, ok := index[key]; ok {
+			terms[i].coefficient += t.coefficient
+			continue
+		}
+		index[key] = len(terms)
+		terms = append(terms, t)
+	}
+
+	// the constant term is written last
+	if i, ok := index[factorsKey(nil)]; ok {
+		terms = append(append(terms[:i:i], terms[i+1:]...), terms[i])
+	}
+
+	var sum Node
+	for _, t := range terms {
+		if t.coefficient == 0 && !e.anyNonFinite(t.factors) {
+			continue
+		}
+
+		magnitude := product(math.Abs(t.coefficient), t.factors)
+
+		switch {
+		case sum == nil && t.coefficient == -1 && len(t.factors) != 0:
+			sum = &UnaryNode{Operator: "-", Operand: magnitude}
+		case sum == nil:
+			sum = product(t.coefficient, t.factors)
+		case t.coefficient < 0:
+			sum = &BinaryNode{Operator: "-", Left: sum, Right: magnitude}
+		default:
+			sum = &BinaryNode{Operator: "+", Left: sum, Right: magnitude}
+		}
+	}
+
+	if len(terms) == 1 && len(terms[0].factors) == 0 {
+		// keeps the sign of -0
+		return number(terms[0].coefficient)
+	}
+	if sum == nil {
+		return number(0)
+	}
+	return e.fold(sum)
+}
+
+// splitTerms splits the node into the terms it is the sum of, each multiplied by sign.
+func splitTerms(node Node, sign float64) []term {
+	switch n := node.(type) {
+	case *UnaryNode:
+		if n.Operator == "-" {
+			return splitTerms(n.Operand, -sign)
+		}
+	case *BinaryNode:
+		switch n.Operator {
+		case "+":
+			return append(splitTerms(n.Left, sign), splitTerms(n.Right, sign)...)
+		case "-":
+			return append(splitTerms(n.Left, sign), splitTerms(n.Right, -sign)...)
+		}
+	}
+
+	t := term{coefficient: sign}
+	splitFactors(node, 1, &t)
+	if math.IsNaN(t.coefficient) || math.IsInf(t.coefficient, 0) {
+		// a term that divides by 0 is left for evaluation
+		t = term{coefficient: sign, factors: []factor{{base: node, exponent: 1}}}
+	}
+	return []term{t}
+}
+
+// splitFactors adds the factors of the node, raised to the power given, to the term.
+func splitFactors(node Node, power float64, t *term) {
+	switch n := node.(type) {
+	case *NumberNode:
+		t.coefficient *= math.Pow(n.Value, power)
+		return
+	case *UnaryNode:
+		if n.Operator == "-" {
+			t.coefficient = -t.coefficient
+			splitFactors(n.Operand, power, t)
+			return
+		}
+	case *BinaryNode:
+		switch n.Operator {
+		case "*":
+			splitFactors(n.Left, power, t)
+			splitFactors(n.Right, power, t)
+			return
+		case "/":
+			splitFactors(n.Left, power, t)
+			splitFactors(n.Right, -power, t)
+			return
+		case "^":
+			exponent, ok := n.Right.(*NumberNode)
+			if base, isNumber := n.Left.(*NumberNode); ok && isNumber {
+				t.coefficient *= math.Pow(base.Value, exponent.Value*power)
+				return
+			}
+			if ok && !math.IsInf(exponent.Value, 0) && !math.IsNaN(exponent.Value) {
+				t.factors = append(t.factors, factor{base: n.Left, exponent: exponent.Value * power})
+				return
+			}
+		}
+	}
+	t.factors = append(t.factors, factor{base: node, exponent: power})
+}
+
+// factorsKey gives the same text for the same factors in any order.
+func factorsKey(factors []factor) string {
+	keys := make([]string, len(factors))
+	for i, f := range factors {
+		keys[i] = Format(f.base) + "^" + strconv.FormatFloat(f.exponent, 'g', -1, 64)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, " * ")
+}
+
+// combineFactors multiplies together the factors with the same base and whole exponents, leaving out those raised to the power of 0.
+// Other exponents can't be added, as x^0.5 * x^0.5 is NaN rather than x for negative x,
+// and neither can constant bases that are NaN or infinite, as 1/0 / (1/0) is NaN rather than 1.
+func (e *Expression) combineFactors(factors []factor) []factor {
+
+	var combined []factor
+	index := map[string]int{}
+
+	for _, f := range factors {
+		if f.exponent != math.Trunc(f.exponent) || e.nonFinite(f.base) {
+			combined = append(combined, f)
+			continue
+		}
+		key := Format(f.base)
+		if i, ok := index[key]; ok {
+			combined[i].exponent += f.exponent
+			continue
+		}
+		index[key] = len(combined)
+		combined = append(combined, f)
+	}
+
+	var result []factor
+	for _, f := range combined {
+		if f.exponent != 0 {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+// product multiplies the coefficient by the factors, dividing by those with negative powers.
+func product(coefficient float64, factors []factor) Node {
+
+	var numerator, denominator Node
+	if coefficient != 1 {
+		numerator = number(coefficient)
+	}
+	for _, f := range factors {
+		if f.exponent > 0 {
+			numerator = multiply(numerator, power(f.base, f.exponent))
+		} else {
+			denominator = multiply(denominator, power(f.base, -f.exponent))
+		}
+	}
+
+	if numerator == nil {
+		numerator = number(1)
+	}
+	if denominator == nil {
+		return numerator
+	}
+	return &BinaryNode{Operator: "/", Left: numerator, Right: denominator}
+}
+
+// multiply multiplies the nodes, where a nil left is 1.
+func multiply(left Node, right Node) Node {
+	if left == nil {
+		return right
+	}
+	return &BinaryNode{Operator: "*", Left: left, Right: right}
+}
+
+func power(base Node, exponent float64) Node {
+	if exponent == 1 {
+		return base
+	}
+	return &BinaryNode{Operator: "^", Left: base, Right: number(exponent)}
+}
@@ -0,0 +1,108 @@
+package expression
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSimplify(t *testing.T) {
+	tests := map[string]string{
+		"0*x + 1*y + 2*3":       "y + 6",
+		"x + 0":                 "x",
+		"0 - x":                 "-x",
+		"x^1 * 1":               "x",
+		"x^0":                   "1",
+		"--x":                   "x",
+		"2*x + y + 3*x":         "5 * x + y",
+		"x*y - y*x":             "0",
+		"2*x*3*x":               "6 * x^2",
+		"2*x/4":                 "0.5 * x",
+		"-x/2 - x":              "-1.5 * x",
+		"x^2/x":                 "x",
+		"(x+1)*(x+1)":           "(x + 1)^2",
+		"sqrt(4) + sin(x)*2":    "2 * sin(x) + 2",
+		"if(1 < 2, x + x, y)":   "2 * x",
+		"0 && x || y":           "0 || y",
+		"(1+2)! + 2^0.5*2^0.5":  "8",
+		"a = 2; b = a*x; b + b": "b = 2 * x; 2 * b",
+		"1/0 + x*0":             "1 / 0",
+		"pi * 2 * pi":           "2 * pi^2",
+		"x^0.5 * x^0.5":         "x^0.5 * x^0.5",
+		"x^2 * y * x^-3":        "y / x",
+		// constants that are NaN or infinite aren't removed
+		"0 * exp(0^-1)": "0 * exp(0^-1)",
+		"0/(2 % 0)":     "0 / (2 % 0)",
+		"1/0 - 1/0 + x": "0 * (1 / 0) + x",
+		"(1/0) / (1/0)": "1 / 0 / (1 / 0)",
+	}
+
+	for input, expected := range tests {
+		expr, err := GetExpression(input)
+		if err != nil {
+			t.Fatalf("Unexpected Error for %s\n%s", input, err)
+		}
+		expr.UseStandardLibrary()
+
+		if s := expr.Simplify().String(); s != expected {
+			t.Errorf("Expected %s to simplify to %s but got %s", input, expected, s)
+		}
+	}
+}
+
+func TestSimplifyKeepsValue(t *testing.T) {
+	expressions := []string{
+		"3*x^2 - 2*x*y + x*y/4 - 7",
+		"(x - y)^2 / (x - y) + x*0.5*y",
+		"if(x > y, x*x*x, -(-y)) + max(x, 2*y - y)",
+		"r = x^2 + y^2; s = r*2 - r; sqrt(s) + s % 3",
+		"x // 2 + exp(x*0 + y) - -x!",
+		"x^0.5 * x^1.5 + y^0.5 / y^0.5",
+		"(2 < -0.5) == 0*exp(0^-1)",
+		"x + 0/(2 % 0) + 0^-1 - 0^-1",
+	}
+
+	for _, input := range expressions {
+		expr, err := GetExpression(input)
+		if err != nil {
+			t.Fatalf("Unexpected Error for %s\n%s", input, err)
+		}
+		expr.UseStandardLibrary()
+		simplified := expr.Simplify()
+
+		for _, point := range [][2]float64{{1, 2}, {3.5, -1}, {4, 0.25}} {
+			variables := map[string]float64{"x": point[0], "y": point[1]}
+			expr.SetVariables(variables)
+			simplified.SetVariables(variables)
+
+			expected, err := expr.Eval()
+			if err != nil {
+				t.Fatalf("Unexpected Error evaluating %s\n%s", input, err)
+			}
+			result, err := simplified.Eval()
+			if err != nil {
+				t.Fatalf("Unexpected Error evaluating %s simplified to %s\n%s", input, simplified, err)
+			}
+
+			if math.IsNaN(result) != math.IsNaN(expected) || math.Abs(result-expected) > 1e-9*math.Max(1, math.Abs(expected)) {
+				t.Errorf("Expected %s simplified to %s to be %f at %v but got %f", input, simplified, expected, point, result)
+			}
+		}
+	}
+}
+
+func TestSimplifyDerivative(t *testing.T) {
+	expr, err := GetExpression("x^3 + 2*sin(x)*x")
+	if err != nil {
+		t.Fatalf("Unexpected Error\n%s", err)
+	}
+	expr.UseStandardLibrary()
+
+	derivative, err := expr.Derive("x")
+	if err != nil {
+		t.Fatalf("Unexpected Error\n%s", err)
+	}
+
+	if s := derivative.Simplify().String(); s != "3 * x^2 + 2 * cos(x) * x + 2 * sin(x)" {
+		t.Errorf("Unexpected simplified derivative %s", s)
+	}
+}
@@ -0,0 +1,162 @@
+package expression
+
+import (
+	"fmt"
+	"math"
+)
+
+// StandardFunctions returns the functions of a single parameter in the standard library.
+//
+//	sin cos tan asin acos atan        trigonometry in radians
+//	sinh cosh tanh asinh acosh atanh  hyperbolic functions
+//	exp ln sqrt cbrt                  exponential, natural logarithm and roots
+//	floor ceil round trunc            rounding, round takes halves away from zero
+//	abs sign                          absolute value and sign, which is -1, 0 or 1
+//	gamma lgamma erf erfc             gamma function, log of its absolute value and error functions
+//
+// A new map is returned each time so it can be changed freely.
+func StandardFunctions() map[string]func(float64) float64 {
+	return map[string]func(float64) float64{
+		"sin":    math.Sin,
+		"cos":    math.Cos,
+		"tan":    math.Tan,
+		"asin":   math.Asin,
+		"acos":   math.Acos,
+		"atan":   math.Atan,
+		"sinh":   math.Sinh,
+		"cosh":   math.Cosh,
+		"tanh":   math.Tanh,
+		"asinh":  math.Asinh,
+		"acosh":  math.Acosh,
+		"atanh":  math.Atanh,
+		"exp":    math.Exp,
+		"ln":     math.Log,
+		"sqrt":   math.Sqrt,
+		"cbrt":   math.Cbrt,
+		"floor":  math.Floor,
+		"ceil":   math.Ceil,
+		"round":  math.Round,
+		"trunc":  math.Trunc,
+		"abs":    math.Abs,
+		"sign":   sign,
+		"gamma":  math.Gamma,
+		"lgamma": lgamma,
+		"erf":    math.Erf,
+		"erfc":   math.Erfc,
+	}
+}
+
+// StandardVariadicFunctions returns the functions of the standard library that take several parameters.
+//
+//	min(a, b, ...) max(a, b, ...)  smallest and largest of any number of values
+//	hypot(a, b, ...)               square root of the sum of the squares
+//	log(x) log(x, base)            logarithm in base 10 or the base given
+//	atan2(y, x)                    angle of the point (x, y)
+//
+// A new map is returned each time so it can be changed freely.
+func StandardVariadicFunctions() map[string]VariadicFunction {
+	return map[string]VariadicFunction{
+		"min": func(args ...float64) (float64, error) {
+			if len(args) == 0 {
+				return 0, parameterError("min", "at least 1", len(args))
+			}
+			result := args[0]
+			for _, arg := range args[1:] {
+				result = math.Min(result, arg)
+			}
+			return result, nil
+		},
+		"max": func(args ...float64) (float64, error) {
+			if len(args) == 0 {
+				return 0, parameterError("max", "at least 1", len(args))
+			}
+			result := args[0]
+			for _, arg := range args[1:] {
+				result = math.Max(result, arg)
+			}
+			return result, nil
+		},
+		"hypot": func(args ...float64) (float64, error) {
+			if len(args) == 0 {
+				return 0, parameterError("hypot", "at least 1", len(args))
+			}
+			result := 0.0
+			for _, arg := range args {
+				result = math.Hypot(result, arg)
+			}
+			return result, nil
+		},
+		"log": func(args ...float64) (float64, error) {
+			switch len(args) {
+			case 1:
+				return math.Log10(args[0]), nil
+			case 2:
+				return math.Log(args[0]) / math.Log(args[1]), nil
+			}
+			return 0, parameterError("log", "1 or 2", len(args))
+		},
+		"atan2": func(args ...float64) (float64, error) {
+			if len(args) != 2 {
+				return 0, parameterError("atan2", "2", len(args))
+			}
+			return math.Atan2(args[0], args[1]), nil
+		},
+	}
+}
+
+// StandardConstants returns the constants of the standard library, pi, tau = 2pi, e and phi, the golden ratio.
+// A new map is returned each time so it can be changed freely.
+func StandardConstants() map[string]float64 {
+	return map[string]float64{
+		"pi":  math.Pi,
+		"tau": 2 * math.Pi,
+		"e":   math.E,
+		"phi": math.Phi,
+	}
+}
+
+// UseStandardLibrary adds the standard library to the functions, variadic functions and globals of the expression.
+// Functions and globals that have already been set take priority over those of the same name in the standard library.
+// The maps previously set are not modified.
+func (e *Expression) UseStandardLibrary() {
+
+	functions := StandardFunctions()
+	for name, f := range e.functions {
+		functions[name] = f
+	}
+
+	variadicFunctions := StandardVariadicFunctions()
+	for name, f := range e.variadicFunctions {
+		variadicFunctions[name] = f
+	}
+
+	globals := StandardConstants()
+	for name, v := range e.globVariables {
+		globals[name] = v
+	}
+
+	e.SetFunctions(functions)
+	e.SetVariadicFunctions(variadicFunctions)
+	e.SetGlobals(globals)
+}
+
+func sign(x float64) float64 {
+	switch {
+	case x > 0:
+		return 1
+	case x < 0:
+		return -1
+	}
+	return x
+}
+
+func lgamma(x float64) float64 {
+	v, _ := math.Lgamma(x)
+	return v
+}
+
+func parameterError(name string, expected string, got int) error {
+	return SyntaxError{
+		Description: fmt.Sprintf("Function with name %s takes %s parameters but got %d", name, expected, got),
+	}
+}
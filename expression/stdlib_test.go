@@ -0,0 +1,115 @@
+package expression
+
+import (
+	"math"
+	"testing"
+)
+
+func TestStandardLibrary(t *testing.T) {
+	tests := []struct {
+		expression string
+		expected   float64
+	}{
+		{"sin(pi/2) + cos(0) + tan(0)", 2},
+		{"asin(1) + acos(1) + atan(1)", 3 * math.Pi / 4},
+		{"cosh(0) + sinh(0) + tanh(0)", 1},
+		{"asinh(sinh(0.5)) + acosh(cosh(2)) + atanh(tanh(0.3))", 2.8},
+		{"exp(1) - e", 0},
+		{"ln(e^2) + sqrt(16) + cbrt(-8)", 4},
+		{"log(1000) + log(8, 2)", 6},
+		{"floor(-1.5) + ceil(1.2) + round(2.5) + trunc(-1.7)", 2},
+		{"abs(-3) * sign(-2) + sign(0)", -3},
+		{"gamma(5) + lgamma(1) + erf(0) + erfc(0)", 25},
+		{"min(3, -1, 2) + max(3, -1, 2) + max(4)", 6},
+		{"hypot(3, 4) + hypot(2, 3, 6)", 12},
+		{"atan2(1, -1)", 3 * math.Pi / 4},
+		{"tau - 2*pi + phi^2 - phi", 1},
+	}
+
+	for _, test := range tests {
+		expr, err := GetExpression(test.expression)
+		if err != nil {
+			t.Fatalf("Problem setting up expression, %s", err)
+		}
+		expr.UseStandardLibrary()
+
+		result, err := expr.Eval()
+		if err != nil {
+			t.Errorf("Unexpected error for %s\n%s", test.expression, err)
+		} else if math.Abs(result-test.expected) > 1e-12 {
+			t.Errorf("Unexpected answer for %s, expected %f but got %f", test.expression, test.expected, result)
+		}
+	}
+}
+
+func TestStandardLibraryWrongParameters(t *testing.T) {
+	for _, expression := range []string{"min()", "log(1, 2, 3)", "atan2(1)", "sin(1, 2)"} {
+		expr, err := GetExpression(expression)
+		if err != nil {
+			t.Fatalf("Problem setting up expression, %s", err)
+		}
+		expr.UseStandardLibrary()
+
+		if _, err := expr.Eval(); err == nil {
+			t.Errorf("Expected an error for %s but got nothing.", expression)
+		}
+	}
+}
+
+func TestStandardLibraryKeepsExisting(t *testing.T) {
+	expr, err := GetExpression("sin(x) + pi + max(1, 2)")
+	if err != nil {
+		t.Fatalf("Problem setting up expression, %s", err)
+	}
+
+	expr.SetFunctions(map[string]func(float64) float64{
+		"sin": func(v float64) float64 { return 10 },
+	})
+	expr.SetGlobals(map[string]float64{"pi": 3})
+	expr.UseStandardLibrary()
+	expr.SetVariables(map[string]float64{"x": 0})
+
+	result, err := expr.Eval()
+	if err != nil {
+		t.Fatalf("Unexpected Error\n%s", err)
+	}
+	if result != 15 {
+		t.Fatalf("Unexpected answer, expected 15 but got %f", result)
+	}
+}
+
+func TestStandardLibraryDerivatives(t *testing.T) {
+	for name := range defaultDerivatives {
+		expr, err := GetExpression(name + "(x)")
+		if err != nil {
+			t.Fatalf("Problem setting up expression, %s", err)
+		}
+		expr.UseStandardLibrary()
+
+		for _, x := range []float64{0.3, 1.7, -0.6} {
+			expr.SetVariables(map[string]float64{"x": x})
+			if v, err := expr.Eval(); err != nil || math.IsNaN(v) {
+				// outside of the domain of the function
+				continue
+			}
+
+			numeric, err := expr.Differentiate("x")
+			if err != nil {
+				t.Fatalf("Unexpected Error\n%s", err)
+			}
+
+			derived, err := expr.Derive("x")
+			if err != nil {
+				t.Fatalf("Derive of %s failed, %s", name, err)
+			}
+			result, err := derived.Eval()
+			if err != nil {
+				t.Fatalf("Evaluating derivative of %s failed, %s", name, err)
+			}
+
+			if math.Abs(result-numeric) > 1e-6*math.Max(1, math.Abs(result)) {
+				t.Errorf("Derivative of %s at %f incorrect, expected %f but got %f", name, x, numeric, result)
+			}
+		}
+	}
+}
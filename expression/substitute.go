@@ -0,0 +1,161 @@
+package expression
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Substitute returns a new Expression with every variable named in the map replaced by the expression it maps to,
+// eg. substituting r*cos(t) for x in x^2 + y^2 gives (r * cos(t))^2 + y^2.
+// The replacements are made at the same time, so the variables of a replacement are never replaced themselves.
+// Names assigned in a program that would hide the variables of a replacement are renamed by adding a number, eg. t1.
+// The names assigned by a replacement that is a program are assigned at the start of the statement it is put in,
+// eg. substituting t = 2; t*u for x in r = x^2; r + 1 gives t = 2; r = (t * u)^2; r + 1.
+// The result shares the globals, functions and derivatives of this expression, which are used by the replacements too.
+// The functions defined by the programs of the replacements are defined by the result, and an error is returned
+// if they are defined differently by this expression or another replacement, or could then call themselves.
+// Variables that only appear in replacements take their values from the first of them, in order of the names replaced.
+// Errors from a replacement are reported at the position of the variable it replaced.
+func (e *Expression) Substitute(replacements map[string]*Expression) (*Expression, error) {
+
+	used := freeNames(e.root)
+	var names []string
+	for name := range replacements {
+		if _, ok := used[name]; ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	// the variables of the replacements, which names assigned around them mustn't hide
+	hidden := map[string]bool{}
+	for _, name := range names {
+		for free := range freeNames(replacements[name].root) {
+			hidden[free] = true
+		}
+	}
+
+	functions := map[string]*Function{}
+	for name, f := range e.programFunctions {
+		functions[name] = f
+	}
+	for _, name := range names {
+		for _, defined := range sortedNames(replacements[name].programFunctions) {
+			f := replacements[name].programFunctions[defined]
+			if g, ok := functions[defined]; ok && !sameFunction(f, g) {
+				return nil, fmt.Errorf("Function %s is defined differently by the replacement for %s", defined, name)
+			}
+			functions[defined] = f
+		}
+	}
+
+	root := renameAssigned(e.root, hidden)
+	root = rewriteFree(root, func(v *VariableNode) Node {
+		if replacement, ok := replacements[v.Name]; ok {
+			return respan(replacement.root, v.Span)
+		}
+		return v
+	})
+
+	substituted := e.withRoot(hoistAssignments(root))
+	if len(functions) != len(e.programFunctions) {
+		// the functions set by SetDefinedFunctions are those that aren't defined by the program
+		given := map[string]*Function{}
+		for name, f := range e.definedFunctions {
+			if _, ok := e.programFunctions[name]; !ok {
+				given[name] = f
+			}
+		}
+		substituted.programFunctions = functions
+		if err := substituted.SetDefinedFunctions(given); err != nil {
+			return nil, err
+		}
+	}
+	// values already taken, from this expression or an earlier replacement
+	taken := map[string]bool{}
+	for name := range e.Variables() {
+		taken[name] = true
+	}
+	variables := substituted.Variables()
+	for _, name := range names {
+		for variable, value := range replacements[name].Variables() {
+			if !taken[variable] {
+				variables[variable] = value
+				taken[variable] = true
+			}
+		}
+	}
+
+	return substituted, nil
+}
+
+// sameFunction checks if the functions have the same parameters and body.
+func sameFunction(f, g *Function) bool {
+	if f == g {
+		return true
+	}
+	if len(f.Parameters) != len(g.Parameters) {
+		return false
+	}
+	for i, parameter := range f.Parameters {
+		if g.Parameters[i] != parameter {
+			return false
+		}
+	}
+	return Format(f.Body) == Format(g.Body)
+}
+
+// renameAssigned renames the names assigned in the tree that are hidden, adding a number so they don't match any other name.
+func renameAssigned(node Node, hidden map[string]bool) Node {
+
+	if len(hidden) == 0 {
+		return node
+	}
+
+	taken := usedNames(node)
+	for name := range hidden {
+		taken[name] = true
+	}
+
+	return Rewrite(node, func(n Node) Node {
+		a, ok := n.(*AssignNode)
+		if !ok || !hidden[a.Name] {
+			return n
+		}
+
+		name := freshName(a.Name, taken)
+
+		body := rewriteFree(a.Body, func(v *VariableNode) Node {
+			if v.Name == a.Name {
+				v.Name = name
+			}
+			return v
+		})
+		return &AssignNode{Name: name, Value: a.Value, Body: body, Span: a.Span}
+	})
+}
+
+// respan copies the tree, giving every node the span given.
+func respan(node Node, span Span) Node {
+	return Rewrite(node, func(n Node) Node {
+		switch n := n.(type) {
+		case *NumberNode:
+			n.Span = span
+		case *VariableNode:
+			n.Span = span
+		case *UnaryNode:
+			n.Span = span
+		case *PostfixNode:
+			n.Span = span
+		case *BinaryNode:
+			n.Span = span
+		case *ConditionalNode:
+			n.Span = span
+		case *AssignNode:
+			n.Span = span
+		case *CallNode:
+			n.Span = span
+		}
+		return n
+	})
+}
@@ -0,0 +1,176 @@
+package expression
+
+import (
+	"math"
+	"testing"
+)
+
+func mustParse(t *testing.T, input string) *Expression {
+	expr, err := GetExpression(input)
+	if err != nil {
+		t.Fatalf("Unexpected Error for %s\n%s", input, err)
+	}
+	return expr
+}
+
+func TestSubstitute(t *testing.T) {
+	model := mustParse(t, "a*x^2 + y")
+	model.SetVariables(map[string]float64{"a": 3})
+
+	polar := map[string]*Expression{
+		"x": mustParse(t, "r*cos(t)"),
+		"y": mustParse(t, "r*sin(t)"),
+	}
+	polar["x"].SetVariables(map[string]float64{"r": 2, "t": 0.5})
+
+	substituted, err := model.Substitute(polar)
+	if err != nil {
+		t.Fatalf("Unexpected Error\n%s", err)
+	}
+	substituted.SetFunctions(map[string]func(float64) float64{"sin": math.Sin, "cos": math.Cos})
+
+	if s := substituted.String(); s != "a * (r * cos(t))^2 + r * sin(t)" {
+		t.Errorf("Unexpected substitution %s", s)
+	}
+
+	variables := substituted.Variables()
+	if len(variables) != 3 || variables["a"] != 3 || variables["r"] != 2 || variables["t"] != 0.5 {
+		t.Errorf("Unexpected variables %v", variables)
+	}
+
+	result, err := substituted.Eval()
+	if err != nil {
+		t.Fatalf("Unexpected Error\n%s", err)
+	}
+	expected := 3*math.Pow(2*math.Cos(0.5), 2) + 2*math.Sin(0.5)
+	if math.Abs(result-expected) > 1e-12 {
+		t.Errorf("Unexpected answer, expected %f but got %f", expected, result)
+	}
+
+	// the original is unchanged
+	if s := model.String(); s != "a * x^2 + y" {
+		t.Errorf("Substituting changed the original to %s", s)
+	}
+}
+
+func TestSubstituteAtOnce(t *testing.T) {
+	swapped, err := mustParse(t, "x - y").Substitute(map[string]*Expression{
+		"x": mustParse(t, "y"),
+		"y": mustParse(t, "x"),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected Error\n%s", err)
+	}
+
+	if s := swapped.String(); s != "y - x" {
+		t.Errorf("Expected y - x but got %s", s)
+	}
+}
+
+func TestSubstituteScope(t *testing.T) {
+	tests := []struct {
+		expression string
+		name       string
+		value      string
+		expected   string
+	}{
+		// the assigned t would hide the t of the replacement
+		{"t = 2; x + t", "x", "3*t", "t1 = 2; 3 * t + t1"},
+		// the assigned x isn't replaced, but is renamed as the replacement uses the x outside the program
+		{"x = 1; x + y", "y", "x*2", "x1 = 1; x1 + x * 2"},
+		{"a = 1; b = a + 1; a * b + y", "y", "a", "a1 = 1; b = a1 + 1; a1 * b + a"},
+		// names that don't hide anything are kept
+		{"s = 2; s * x", "x", "t + 1", "s = 2; s * (t + 1)"},
+		// the new name doesn't match a name already used
+		{"t = 2; t1 = 3; x + t + t1", "x", "t", "t2 = 2; t1 = 3; t + t2 + t1"},
+		{"t = 2; t = t*3; x*t", "x", "t", "t2 = 2; t1 = t2 * 3; t * t1"},
+		// the names assigned by a replacement go at the start of the statement it is put in
+		{"r = x^2; r + 1", "x", "t = 2; t*y", "t = 2; r = (t * y)^2; r + 1"},
+		{"r = x^2; t + r", "x", "t = 2; t*y", "t1 = 2; r = (t1 * y)^2; t + r"},
+		{"x + 2*x", "x", "a = y; a^2", "a1 = y; a2 = y; a1^2 + 2 * a2^2"},
+		// and the functions it defines are defined by the result
+		{"f(t) = t^2; f(x) + 1", "x", "g(a) = a + 1; g(y)", "f(t) = t^2; g(a) = a + 1; f(g(y)) + 1"},
+		{"x*2", "x", "f(a) = a + 1; f(t)", "f(a) = a + 1; f(t) * 2"},
+	}
+
+	for _, test := range tests {
+		substituted, err := mustParse(t, test.expression).Substitute(map[string]*Expression{
+			test.name: mustParse(t, test.value),
+		})
+		if err != nil {
+			t.Fatalf("Unexpected Error substituting %s for %s in %s\n%s", test.value, test.name, test.expression, err)
+		}
+
+		if s := substituted.String(); s != test.expected {
+			t.Errorf("Expected substituting %s for %s in %s to give %s but got %s", test.value, test.name, test.expression, test.expected, s)
+		}
+
+		// the renamed names can be parsed, so the result parses back to an expression with the same value
+		parsed, err := GetExpression(substituted.String())
+		if err != nil {
+			t.Errorf("Expected %s to parse back but got %s", substituted, err)
+			continue
+		}
+		variables := map[string]float64{"a": 3, "t": 5, "x": 7, "y": 11}
+		substituted.SetVariables(variables)
+		parsed.SetVariables(variables)
+		want, err := substituted.Eval()
+		if err != nil {
+			t.Fatalf("Unexpected Error evaluating %s\n%s", substituted, err)
+		}
+		if got, err := parsed.Eval(); err != nil || got != want {
+			t.Errorf("Expected %s parsed back to be %f but got %f, %v", substituted, want, got, err)
+		}
+	}
+}
+
+func TestSubstituteErrorPosition(t *testing.T) {
+	substituted, err := mustParse(t, "1 + 2*x").Substitute(map[string]*Expression{
+		"x": mustParse(t, "foo(y)"),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected Error\n%s", err)
+	}
+
+	_, err = substituted.Eval()
+	syntaxError, ok := err.(SyntaxError)
+	if !ok {
+		t.Fatalf("Expected a SyntaxError but got %v", err)
+	}
+	if syntaxError.Position != 6 || syntaxError.End != 7 {
+		t.Errorf("Expected the error to be at x but got %d to %d", syntaxError.Position, syntaxError.End)
+	}
+}
+
+func TestSubstituteFunctionConflicts(t *testing.T) {
+	tests := []struct {
+		expression   string
+		replacements map[string]string
+	}{
+		{"f(x) = x; f(y)", map[string]string{"y": "f(a) = 2*a; f(t)"}},
+		{"x + y", map[string]string{"x": "f(a) = a; f(t)", "y": "f(b) = b; f(t)"}},
+		{"f(a) = g(a); f(x)", map[string]string{"x": "g(a) = f(a); g(t)"}},
+	}
+
+	for _, test := range tests {
+		replacements := map[string]*Expression{}
+		for name, replacement := range test.replacements {
+			replacements[name] = mustParse(t, replacement)
+		}
+		if _, err := mustParse(t, test.expression).Substitute(replacements); err == nil {
+			t.Errorf("Expected an error substituting %v in %s but got nothing.", test.replacements, test.expression)
+		}
+	}
+
+	// the same function can be defined by several replacements
+	substituted, err := mustParse(t, "x + y").Substitute(map[string]*Expression{
+		"x": mustParse(t, "f(a) = a^2; f(t)"),
+		"y": mustParse(t, "f(a) = a^2; f(2*t)"),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected Error\n%s", err)
+	}
+	if s := substituted.String(); s != "f(a) = a^2; f(t) + f(2 * t)" {
+		t.Errorf("Unexpected substitution %s", s)
+	}
+}
@@ -1,22 +1,59 @@
 package expression
 
 import (
+	"math"
 	"strconv"
+	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
-func tokenizer(input string) ([]token, error) {
+// tokenizer splits the input into tokens.
+// Errors are added to errs, so when it is recovering from errors the tokens are returned along with the errors found.
+func tokenizer(input string, options ParseOptions, errs *errorList) ([]token, error) {
 
 	var tokens []token
 
 	var numberBuffer []rune
 	var letterBuffer []rune
+	numberStart := 0
+	letterStart := 0
+
+	// flush adds the number or name being read to the tokens
+	flush := func() error {
+		if len(numberBuffer) != 0 {
+			number, err := numberToken(numberBuffer, numberStart, errs)
+			if err != nil {
+				return err
+			}
+
+			tokens = append(tokens, number)
+			numberBuffer = []rune{}
+		}
+		if len(letterBuffer) != 0 {
+			tokens = append(tokens, nameToken(tokenVariable, letterBuffer, letterStart))
+			letterBuffer = []rune{}
+		}
+		return nil
+	}
 
 	interruptedToken := false
+	// the number of characters of an operator already read
+	skip := 0
 
 	for index, character := range input {
 
-		if character == ' ' {
+		if skip > 0 {
+			skip--
+			continue
+		}
+
+		// an invalid byte is read as utf8.RuneError, which is longer than the byte
+		_, size := utf8.DecodeRuneInString(input[index:])
+		end := index + size
+
+		// tabs and newlines separate tokens like spaces, so programs can be written over several lines
+		if unicode.IsSpace(character) {
 			if len(letterBuffer) != 0 || len(numberBuffer) != 0 {
 				interruptedToken = true
 			}
@@ -24,155 +61,328 @@ func tokenizer(input string) ([]token, error) {
 		}
 
 		if interruptedToken && (isNumber(character) || isLetter(character)) {
-			return nil, SyntaxError{
+			if err := errs.add(SyntaxError{
 				Description: "Interrupted token",
 				Position:    index,
+				End:         end,
+			}); err != nil {
+				return nil, err
 			}
+
+			// carry on with a new token
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			interruptedToken = false
+		}
+
+		// with implicit multiplication 2e is 2*e, so only treat it as an exponent if there are digits after it
+		exponent := !options.ImplicitMultiplication || startsExponent(input[end:])
+		if isExponent(character) && len(numberBuffer) != 0 && !hasExponent(numberBuffer) && exponent {
+			numberBuffer = append(numberBuffer, character)
+			continue
+		}
+
+		if (character == '+' || character == '-') && len(numberBuffer) != 0 && isExponent(numberBuffer[len(numberBuffer)-1]) {
+			numberBuffer = append(numberBuffer, character)
+			continue
 		}
 
-		if isNumber(character) {
+		// a bracketed group or factorial followed by a number, letter or group is multiplied by it
+		if options.ImplicitMultiplication && len(numberBuffer) == 0 && len(letterBuffer) == 0 &&
+			(closesGroup(tokens) || endsPostfix(tokens)) &&
+			(isNumber(character) || isLetter(character) || character == '(') {
+			tokens = append(tokens, multiplyToken(index))
+		}
+
+		if isNumber(character) && len(letterBuffer) != 0 && unicode.IsDigit(character) {
+			// digits after the first letter are part of the name, eg. atan2 or x1
+			letterBuffer = append(letterBuffer, character)
+
+		} else if isNumber(character) {
 			if len(letterBuffer) != 0 {
-				return nil, SyntaxError{
+				if err := errs.add(SyntaxError{
 					Description: "Number following letter",
 					Position:    index,
+					End:         end,
+				}); err != nil {
+					return nil, err
+				}
+
+				if err := flush(); err != nil {
+					return nil, err
 				}
 			}
 
+			if len(numberBuffer) == 0 {
+				numberStart = index
+			}
 			numberBuffer = append(numberBuffer, character)
 
 		} else if isLetter(character) {
 
 			if len(numberBuffer) != 0 {
-				return nil, SyntaxError{
-					Description: "Letter following number",
-					Position:    index,
+				if !options.ImplicitMultiplication {
+					if err := errs.add(SyntaxError{
+						Description: "Letter following number",
+						Position:    index,
+						End:         end,
+					}); err != nil {
+						return nil, err
+					}
+				}
+
+				if err := flush(); err != nil {
+					return nil, err
+				}
+				if options.ImplicitMultiplication {
+					tokens = append(tokens, multiplyToken(index))
 				}
 			}
 
+			if len(letterBuffer) == 0 {
+				letterStart = index
+			}
 			letterBuffer = append(letterBuffer, character)
 
 		} else if isOperator(character) {
+			operator := readOperator(input[index:])
+			// a lone & or | isn't an operator, so it is dropped like any other unknown character
+			if operator == "" && options.IgnoreUnknownCharacters {
+				continue
+			}
+
 			interruptedToken = false
-			// flush buffers
-			if len(numberBuffer) != 0 {
-				num, err := toNumber(numberBuffer)
-				if err != nil {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+
+			if operator == "" {
+				if err := errs.add(SyntaxError{
+					Description: "Unknown operator",
+					Position:    index,
+					End:         end,
+				}); err != nil {
 					return nil, err
 				}
+				continue
+			}
+			skip = len(operator) - 1
+			end = index + len(operator)
 
+			// check if it's a negation rather than a minus sign
+			if operator == "-" && !followsValue(tokens) {
 				tokens = append(tokens, token{
-					kind:  tokenNumber,
-					value: num,
+					kind:  tokenFunction,
+					value: negateFunction,
+					arity: 1,
+					start: index,
+					end:   end,
 				})
-				numberBuffer = []rune{}
+				continue
 			}
-			if len(letterBuffer) != 0 {
+
+			// ! after a value is a factorial rather than a logical not
+			if operator == "!" && followsValue(tokens) {
 				tokens = append(tokens, token{
-					kind:  tokenVariable,
-					value: toString(letterBuffer),
+					kind:  tokenPostfix,
+					value: operator,
+					start: index,
+					end:   end,
 				})
-				letterBuffer = []rune{}
+				continue
 			}
 
-			// check if it's a negation rather than a minus sign
-			if character == '-' {
-				if len(tokens) == 0 {
-					tokens = append(tokens, token{
-						kind:  tokenFunction,
-						value: negateFunction,
-					})
-					continue
-				} else {
-					leftNum := tokens[len(tokens)-1].kind == tokenNumber
-					leftVar := tokens[len(tokens)-1].kind == tokenVariable
-					leftRightBracket := tokens[len(tokens)-1].kind == tokenSeparator && tokens[len(tokens)-1].value.(rune) == ')'
-					if !leftNum && !leftVar && !leftRightBracket {
-						tokens = append(tokens, token{
-							kind:  tokenFunction,
-							value: negateFunction,
-						})
-						continue
-					}
-				}
+			if operator == "!" {
+				tokens = append(tokens, token{
+					kind:  tokenFunction,
+					value: notFunction,
+					arity: 1,
+					start: index,
+					end:   end,
+				})
+				continue
 			}
 
 			tokens = append(tokens, token{
 				kind:  tokenOperator,
-				value: character,
+				value: operator,
+				start: index,
+				end:   end,
 			})
 
 		} else if isSeparator(character) {
 			interruptedToken = false
 			if character == '(' {
 				if len(numberBuffer) != 0 {
-					return nil, SyntaxError{
-						Description: "Number before opening bracket",
-						Position:    index,
+					if !options.ImplicitMultiplication {
+						if err := errs.add(SyntaxError{
+							Description: "Number before opening bracket",
+							Position:    index,
+							End:         end,
+						}); err != nil {
+							return nil, err
+						}
 					}
-				}
 
-				if len(letterBuffer) != 0 {
-					tokens = append(tokens, token{
-						kind:  tokenFunction,
-						value: string(letterBuffer),
-					})
-					letterBuffer = []rune{}
-				}
-			} else if character == ')' {
-				if len(numberBuffer) != 0 {
-					num, err := toNumber(numberBuffer)
-					if err != nil {
+					if err := flush(); err != nil {
 						return nil, err
 					}
-
-					tokens = append(tokens, token{
-						kind:  tokenNumber,
-						value: num,
-					})
-					numberBuffer = []rune{}
+					if options.ImplicitMultiplication {
+						tokens = append(tokens, multiplyToken(index))
+					}
 				}
+
 				if len(letterBuffer) != 0 {
-					tokens = append(tokens, token{
-						kind:  tokenVariable,
-						value: toString(letterBuffer),
-					})
+					fn := nameToken(tokenFunction, letterBuffer, letterStart)
+					if fn.value == "if" {
+						fn.value = conditionalFunction
+					}
+					tokens = append(tokens, fn)
 					letterBuffer = []rune{}
 				}
+			} else if err := flush(); err != nil {
+				return nil, err
 			}
 			tokens = append(tokens, token{
 				kind:  tokenSeparator,
 				value: character,
+				start: index,
+				end:   end,
 			})
+
+		} else if !options.IgnoreUnknownCharacters {
+			if err := errs.add(SyntaxError{
+				Description: "Unknown character",
+				Position:    index,
+				End:         end,
+			}); err != nil {
+				return nil, err
+			}
+
+			// carry on as if the character separated the tokens around it
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			interruptedToken = false
+		}
+
+	}
+
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+
+}
+
+// multiplyToken creates the multiplication inserted by implicit multiplication at the position given, which has no width.
+func multiplyToken(position int) token {
+	return token{
+		kind:  tokenOperator,
+		value: "*",
+		start: position,
+		end:   position,
+	}
+}
+
+// numberToken creates a token for the number with the characters given starting at the position given.
+// An invalid number is NaN when recovering from errors.
+func numberToken(chars []rune, start int, errs *errorList) (token, error) {
+	num, err := toNumber(chars, start)
+	if err != nil {
+		if err := errs.add(err.(SyntaxError)); err != nil {
+			return token{}, err
 		}
+		num = math.NaN()
+	}
+	return token{
+		kind:  tokenNumber,
+		value: num,
+		start: start,
+		end:   start + len(string(chars)),
+	}, nil
+}
 
+// nameToken creates a token of the kind given for the name with the characters given starting at the position given.
+func nameToken(kind tokenKind, chars []rune, start int) token {
+	return token{
+		kind:  kind,
+		value: toString(chars),
+		start: start,
+		end:   start + len(string(chars)),
 	}
+}
+
+// operators made of two characters, which are read before the operators made of their first character.
+var longOperators = []string{"<=", ">=", "==", "!=", "&&", "||", "//"}
 
-	if len(numberBuffer) != 0 {
-		num, err := toNumber(numberBuffer)
-		if err != nil {
-			return nil, err
+// readOperator reads the operator at the start of the input, returning an empty string if it isn't a known operator.
+func readOperator(input string) string {
+	for _, operator := range longOperators {
+		if strings.HasPrefix(input, operator) {
+			return operator
 		}
+	}
 
-		tokens = append(tokens, token{
-			kind:  tokenNumber,
-			value: num,
-		})
-		numberBuffer = []rune{}
+	switch input[0] {
+	case '+', '-', '*', '/', '%', '^', '<', '>', '!', '=':
+		return input[:1]
 	}
-	if len(letterBuffer) != 0 {
-		tokens = append(tokens, token{
-			kind:  tokenVariable,
-			value: toString(letterBuffer),
-		})
-		letterBuffer = []rune{}
+	return ""
+}
+
+// followsValue checks if the last token ends a value, so an operator after it has a left operand.
+func followsValue(tokens []token) bool {
+	if len(tokens) == 0 {
+		return false
 	}
+	last := tokens[len(tokens)-1]
+	return last.kind == tokenNumber || last.kind == tokenVariable || last.kind == tokenPostfix || closesGroup(tokens)
+}
 
-	return tokens, nil
+// closesGroup checks if the last token is a closing bracket.
+func closesGroup(tokens []token) bool {
+	if len(tokens) == 0 {
+		return false
+	}
+	last := tokens[len(tokens)-1]
+	return last.kind == tokenSeparator && last.value.(rune) == ')'
+}
 
+// endsPostfix checks if the last token is a postfix operator, eg. the ! of 3!.
+func endsPostfix(tokens []token) bool {
+	return len(tokens) != 0 && tokens[len(tokens)-1].kind == tokenPostfix
 }
 
-func toNumber(chars []rune) (float64, error) {
-	return strconv.ParseFloat(string(chars), 64)
+// startsExponent checks if the input starts with the digits of an exponent, optionally signed.
+func startsExponent(input string) bool {
+	if len(input) != 0 && (input[0] == '+' || input[0] == '-') {
+		input = input[1:]
+	}
+	return len(input) != 0 && input[0] >= '0' && input[0] <= '9'
+}
+
+func toNumber(chars []rune, position int) (float64, error) {
+	last := chars[len(chars)-1]
+	if isExponent(last) || last == '+' || last == '-' {
+		return 0, SyntaxError{
+			Description: "Missing digits in exponent",
+			Position:    position + len(string(chars)),
+			End:         position + len(string(chars)) + 1,
+		}
+	}
+
+	num, err := strconv.ParseFloat(string(chars), 64)
+	if err != nil {
+		return 0, SyntaxError{
+			Description: "Invalid number",
+			Position:    position,
+			End:         position + len(string(chars)),
+		}
+	}
+	return num, nil
 }
 
 func toString(chars []rune) string {
@@ -183,14 +393,27 @@ func isNumber(char rune) bool {
 	return unicode.IsDigit(char) || char == '.'
 }
 
+func isExponent(char rune) bool {
+	return char == 'e' || char == 'E'
+}
+
+func hasExponent(chars []rune) bool {
+	for _, char := range chars {
+		if isExponent(char) {
+			return true
+		}
+	}
+	return false
+}
+
 func isLetter(char rune) bool {
 	return unicode.IsLetter(char)
 }
 
 func isOperator(char rune) bool {
-	return char == '+' || char == '-' || char == '*' || char == '/' || char == '^'
+	return strings.ContainsRune("+-*/%^<>=!&|", char)
 }
 
 func isSeparator(char rune) bool {
-	return char == '(' || char == ')'
+	return char == '(' || char == ')' || char == ',' || char == ';'
 }
@@ -1,12 +1,292 @@
 package expression
 
-import "testing"
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+)
 
 func TestTokeniser(t *testing.T) {
 	expression := "2 * 3 * (2 + 4)"
-	_, err := tokenizer(expression)
+	_, err := tokenizer(expression, ParseOptions{}, &errorList{})
 
 	if err != nil {
 		t.Fatalf("Tokeniser errored with message %s", err)
 	}
 }
+
+func TestTokeniserScientificNotation(t *testing.T) {
+	tests := map[string]float64{
+		"1.5e-3":  1.5e-3,
+		"6.02E23": 6.02e23,
+		"2e+2":    200,
+		"3e2":     300,
+		".5e1":    5,
+	}
+
+	for expression, expected := range tests {
+		tokens, err := tokenizer(expression, ParseOptions{}, &errorList{})
+		if err != nil {
+			t.Fatalf("Tokeniser errored with message %s", err)
+		}
+
+		if len(tokens) != 1 || tokens[0].kind != tokenNumber {
+			t.Fatalf("Expected %s to be a single number but got %v", expression, tokens)
+		}
+
+		if tokens[0].value.(float64) != expected {
+			t.Errorf("Expected %s to be %g but got %g", expression, expected, tokens[0].value.(float64))
+		}
+	}
+}
+
+func TestTokeniserScientificNotationInExpression(t *testing.T) {
+	result, err := EvalExpression("2e3-1E-1*-1e1 + 1e1")
+	if err != nil {
+		t.Fatalf("Unexpected Error\n%s", err)
+	}
+
+	if result != 2011 {
+		t.Fatalf("Unexpected answer, expected %f but got %f", 2011.0, result)
+	}
+}
+
+func TestTokeniserBadScientificNotation(t *testing.T) {
+	tests := map[string]int{
+		"1e":       2,
+		"1e+":      3,
+		"2 * 10E-": 8,
+		"1e-)":     3,
+		"1.2.3":    0,
+		"3 + 1.e.": 4,
+	}
+
+	for expression, position := range tests {
+		_, err := tokenizer(expression, ParseOptions{}, &errorList{})
+		if err == nil {
+			t.Fatalf("Expected an error for %s but got nothing.", expression)
+		}
+
+		syntaxError, ok := err.(SyntaxError)
+		if !ok {
+			t.Fatalf("Expected a SyntaxError for %s but got %T", expression, err)
+		}
+
+		if syntaxError.Position != position {
+			t.Errorf("Expected the error for %s in position %d but got %d", expression, position, syntaxError.Position)
+		}
+	}
+}
+
+func TestTokeniserUnknownCharacters(t *testing.T) {
+	tests := map[string]int{
+		"2 # 3":  2,
+		"a & b":  2,
+		"x$":     1,
+		"3 × 4":  2,
+		"x² + 1": 1,
+		"a ? b":  2,
+	}
+
+	for expression, position := range tests {
+		_, err := GetExpression(expression)
+		syntaxError, ok := err.(SyntaxError)
+		if !ok {
+			t.Errorf("Expected a SyntaxError for %s but got %v", expression, err)
+			continue
+		}
+
+		if syntaxError.Position != position {
+			t.Errorf("Expected the error for %s in position %d but got %d", expression, position, syntaxError.Position)
+		}
+	}
+
+	expr, err := GetExpressionWithOptions("a#b + c$ + d&e + f|g && h", ParseOptions{IgnoreUnknownCharacters: true})
+	if err != nil {
+		t.Fatalf("Unexpected Error\n%s", err)
+	}
+	if len(expr.Variables()) != 5 {
+		t.Errorf("Expected the unknown characters to be dropped but got the variables %v", expr.Variables())
+	}
+}
+
+func TestTokeniserWhitespace(t *testing.T) {
+	result, err := EvalExpression("a = 2;\n\tb = 3;\r\na * b")
+	if err != nil {
+		t.Fatalf("Unexpected Error\n%s", err)
+	}
+	if result != 6 {
+		t.Errorf("Unexpected answer, expected %f but got %f", 6.0, result)
+	}
+
+	if _, err := GetExpression("ab\tc"); err == nil {
+		t.Errorf("Expected a tab to separate tokens")
+	}
+}
+
+func TestTokeniserDigitsInNames(t *testing.T) {
+	tokens, err := tokenizer("x1 + atan2(y10, 3)", ParseOptions{}, &errorList{})
+	if err != nil {
+		t.Fatalf("Tokeniser errored with message %s", err)
+	}
+
+	names := map[string]tokenKind{"x1": tokenVariable, "atan2": tokenFunction, "y10": tokenVariable}
+	for _, token := range tokens {
+		if name, ok := token.value.(string); ok && token.kind != tokenOperator {
+			if kind, ok := names[name]; !ok || kind != token.kind {
+				t.Errorf("Unexpected name %s", name)
+			}
+			delete(names, name)
+		}
+	}
+	if len(names) != 0 {
+		t.Errorf("Expected the names %v", names)
+	}
+
+	expr, err := GetExpressionWithOptions("2x1", ParseOptions{ImplicitMultiplication: true})
+	if err != nil {
+		t.Fatalf("Unexpected Error\n%s", err)
+	}
+	if _, ok := expr.Variables()["x1"]; !ok || len(expr.Variables()) != 1 {
+		t.Errorf("Expected only the variable x1 but got %v", expr.Variables())
+	}
+
+	for _, expression := range []string{"x 1", "x.1", "1x"} {
+		if _, err := GetExpression(expression); err == nil {
+			t.Errorf("Expected an error for %s but got nothing.", expression)
+		}
+	}
+}
+
+// FuzzTokeniser parses inputs with each of the parse options, checking that parsing never panics
+// and every input that is accepted prints to text that parses back to the same tree.
+// The seeds include random joins of the pieces of the language, so running the tests without fuzzing still covers them.
+func FuzzTokeniser(f *testing.F) {
+	seeds := []string{
+		"2 * 3 + 2*(5 + 4 / 2) ^ 2", "-(1, 2)", "-()", "!()", "max(1,,x)", "f(x,", "f(x) = x^2; f(3)",
+		"a = 1; b = a*2; a + b", "if(x < 1, -x, x!)", "2x(y + 1)", "1e999", "x # 3", "(1 +", "\x95",
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	pieces := []string{
+		"0", "1", "2.5", ".5", "3e2", "1e-3", "7.", "x", "y", "ab", "x1", "e", "f", "if", "π",
+		"+", "-", "*", "/", "//", "%", "^", "<", "<=", ">", ">=", "==", "!=", "&&", "||", "!", "=",
+		"(", ")", ",", ";", " ", " ", "\t", "\n", "#", "&", "|", "$", "×", "²", "é", " ",
+	}
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 5000; i++ {
+		var input strings.Builder
+		for n := random.Intn(12) + 1; n > 0; n-- {
+			input.WriteString(pieces[random.Intn(len(pieces))])
+		}
+		f.Add(input.String())
+	}
+
+	options := []ParseOptions{
+		{},
+		{ImplicitMultiplication: true},
+		{IgnoreUnknownCharacters: true},
+		{Recover: true},
+		{Recover: true, ImplicitMultiplication: true},
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		for _, o := range options {
+			expr, err := fuzzParse(t, input, o)
+			if expr == nil || (err != nil && !o.Recover) {
+				continue
+			}
+
+			for _, printed := range []string{expr.String(), expr.Parenthesised()} {
+				reparsed, err := fuzzParse(t, printed, ParseOptions{})
+				if err != nil {
+					t.Errorf("%q with options %+v printed as %q which doesn't parse\n%s", input, o, printed, err)
+					continue
+				}
+				if !sameProgram(expr, reparsed) {
+					t.Errorf("%q with options %+v printed as %q which parses back as a different tree", input, o, printed)
+				}
+			}
+		}
+	})
+}
+
+// fuzzParse parses the input, turning a panic into a test failure.
+func fuzzParse(t *testing.T, input string, options ParseOptions) (expr *Expression, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Errorf("Parsing %q with options %+v panicked: %v", input, options, r)
+			expr = nil
+		}
+	}()
+	return GetExpressionWithOptions(input, options)
+}
+
+// sameProgram checks if the expressions have the same tree and define the same functions.
+func sameProgram(a *Expression, b *Expression) bool {
+	if len(a.programFunctions) != len(b.programFunctions) {
+		return false
+	}
+	for name, f := range a.programFunctions {
+		g, ok := b.programFunctions[name]
+		if !ok || strings.Join(f.Parameters, ",") != strings.Join(g.Parameters, ",") || !sameTree(f.Body, g.Body) {
+			return false
+		}
+	}
+	return sameTree(a.root, b.root)
+}
+
+// sameTree checks if the trees are the same apart from their spans, without printing them.
+// NaN and infinities can't be written as numbers, so they match any tree of numbers that calculates them.
+func sameTree(a Node, b Node) bool {
+	switch n := a.(type) {
+	case *NumberNode:
+		if math.IsNaN(n.Value) || math.IsInf(n.Value, 0) {
+			constant := true
+			Inspect(b, func(node Node) bool {
+				switch node.(type) {
+				case *VariableNode, *CallNode, *AssignNode:
+					constant = false
+				}
+				return constant
+			})
+			v, err := NewExpression(b).Eval()
+			return constant && err == nil && (v == n.Value || (math.IsNaN(v) && math.IsNaN(n.Value)))
+		}
+		m, ok := b.(*NumberNode)
+		return ok && m.Value == n.Value
+	case *VariableNode:
+		m, ok := b.(*VariableNode)
+		return ok && m.Name == n.Name
+	case *UnaryNode:
+		m, ok := b.(*UnaryNode)
+		return ok && m.Operator == n.Operator && sameTree(n.Operand, m.Operand)
+	case *PostfixNode:
+		m, ok := b.(*PostfixNode)
+		return ok && m.Operator == n.Operator && sameTree(n.Operand, m.Operand)
+	case *BinaryNode:
+		m, ok := b.(*BinaryNode)
+		return ok && m.Operator == n.Operator && sameTree(n.Left, m.Left) && sameTree(n.Right, m.Right)
+	case *ConditionalNode:
+		m, ok := b.(*ConditionalNode)
+		return ok && sameTree(n.Condition, m.Condition) && sameTree(n.Then, m.Then) && sameTree(n.Else, m.Else)
+	case *AssignNode:
+		m, ok := b.(*AssignNode)
+		return ok && m.Name == n.Name && sameTree(n.Value, m.Value) && sameTree(n.Body, m.Body)
+	case *CallNode:
+		m, ok := b.(*CallNode)
+		if !ok || m.Name != n.Name || len(m.Args) != len(n.Args) {
+			return false
+		}
+		for i := range n.Args {
+			if !sameTree(n.Args[i], m.Args[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	panic("The node is not a valid node type, this should never happen")
+}
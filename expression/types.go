@@ -1,23 +1,179 @@
 package expression
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
 
 //SyntaxError is the error type if the expression contains a syntactical error.
+// Position and End are the byte offsets in the input of the start and end of the part that caused the error.
+// They are both 0 if the error doesn't come from a particular part of the input, eg. for an expression built with NewExpression.
 type SyntaxError struct {
 	Position    int
+	End         int
 	Description string
 }
 
 func (e SyntaxError) Error() string {
-	if e.Position != 0 {
+	if e.located() {
 		return fmt.Sprintf(`"%s" in position %d`, e.Description, e.Position)
 	}
 	return e.Description
 }
 
+func (e SyntaxError) located() bool {
+	return e.Position != 0 || e.End != 0
+}
+
+// Snippet shows the line of the input that the error is in, with the part that caused the error underlined by carets, eg.
+//
+//	2 * (3 + x
+//	    ^
+//
+// Input must be the text that was parsed. Snippet returns an empty string if the error has no position.
+func (e SyntaxError) Snippet(input string) string {
+	if !e.located() {
+		return ""
+	}
+
+	start := e.Position
+	if start > len(input) {
+		start = len(input)
+	}
+	lineStart := strings.LastIndex(input[:start], "\n") + 1
+	lineEnd := len(input)
+	if i := strings.Index(input[start:], "\n"); i >= 0 {
+		lineEnd = start + i
+	}
+
+	end := e.End
+	if end > lineEnd {
+		end = lineEnd
+	}
+	width := 1
+	if end > start {
+		width = len([]rune(input[start:end]))
+	}
+
+	var marker strings.Builder
+	for _, character := range input[lineStart:start] {
+		// keep tabs so the carets line up however wide they are shown
+		if character == '\t' {
+			marker.WriteRune('\t')
+		} else {
+			marker.WriteRune(' ')
+		}
+	}
+	marker.WriteString(strings.Repeat("^", width))
+
+	return input[lineStart:lineEnd] + "\n" + marker.String()
+}
+
+// withSpan gives an error the span given if it is a SyntaxError that doesn't have a position already.
+func withSpan(err error, span Span) error {
+	if syntaxError, ok := err.(SyntaxError); ok && !syntaxError.located() {
+		syntaxError.Position, syntaxError.End = span.Start, span.End
+		return syntaxError
+	}
+	return err
+}
+
+// SyntaxErrors is every syntax error found in an input parsed with ParseOptions.Recover, in order of position.
+type SyntaxErrors []SyntaxError
+
+func (e SyntaxErrors) Error() string {
+	descriptions := make([]string, len(e))
+	for i, err := range e {
+		descriptions[i] = err.Error()
+	}
+	return strings.Join(descriptions, "\n")
+}
+
+// Unwrap returns each of the errors.
+func (e SyntaxErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// errorList collects the syntax errors of an input when recovering from them.
+// The zero value doesn't recover, so parsing stops at the first error.
+type errorList struct {
+	recover bool
+	errors  SyntaxErrors
+}
+
+// add records the error and returns nil when recovering from errors, otherwise it returns the error so parsing stops.
+// Only the first error at each position is kept, as later ones are usually caused by it.
+func (l *errorList) add(err SyntaxError) error {
+	if !l.recover {
+		return err
+	}
+	if err.located() && l.reported(err.Position, err.Position) {
+		return nil
+	}
+	l.errors = append(l.errors, err)
+	return nil
+}
+
+// reported checks if an error has been recorded with a position between start and end inclusive.
+func (l *errorList) reported(start int, end int) bool {
+	for _, err := range l.errors {
+		if err.located() && err.Position >= start && err.Position <= end {
+			return true
+		}
+	}
+	return false
+}
+
+// err returns the errors recorded sorted by position, or nil if there weren't any.
+func (l *errorList) err() error {
+	if len(l.errors) == 0 {
+		return nil
+	}
+	sort.SliceStable(l.errors, func(i, j int) bool {
+		return l.errors[i].Position < l.errors[j].Position
+	})
+	return l.errors
+}
+
+// ParseOptions changes how an expression is parsed, the zero value parses expressions normally.
+type ParseOptions struct {
+	// ImplicitMultiplication multiplies numbers, variables, bracketed groups and factorials written next to each other,
+	// so 2x, 3(a+b), (a+b)(a-b) and 3!x are 2*x, 3*(a+b), (a+b)*(a-b) and 3!*x.
+	// The multiplication has the same precedence as *, so 2x^2 is 2*(x^2) and 1/2x is (1/2)*x.
+	// A name directly before a bracket is always a function call, so a(b) calls a rather than multiplying by b.
+	// A number followed by e is only in scientific notation if digits follow, so 2e is 2*e but 2e3 is 2000.
+	// Digits after a letter are part of the name, so 2x1 is 2*x1.
+	// Negation applies before powers as it does without implicit multiplication, so -x^2 is (-x)^2.
+	// Spaces still separate tokens, so 2 x is an error.
+	ImplicitMultiplication bool
+
+	// IgnoreUnknownCharacters drops characters that aren't part of the language, such as #, × or a & or | on its own,
+	// rather than reporting them.
+	// Dropped characters don't separate tokens, so a#b is the name ab. Any whitespace, including tabs and newlines, separates tokens.
+	IgnoreUnknownCharacters bool
+
+	// Recover carries on parsing after a syntax error to find every error in the input, which are returned as SyntaxErrors.
+	// The expression is still returned for tooling, with missing values replaced by NaN, values written next to each other
+	// multiplied, missing closing brackets added and stray brackets, commas and unknown characters removed.
+	Recover bool
+}
+
 type token struct {
 	kind  tokenKind
 	value interface{}
+	arity int
+	// the byte offsets of the start and end of the token in the input
+	start int
+	end   int
+}
+
+func (t token) span() Span {
+	return Span{Start: t.start, End: t.end}
 }
 
 type tokenKind int
@@ -26,6 +182,7 @@ const (
 	tokenVariable tokenKind = iota
 	tokenFunction
 	tokenOperator
+	tokenPostfix
 	tokenSeparator
 	tokenNumber
 )
@@ -34,4 +191,10 @@ type reservedFunction int
 
 const (
 	negateFunction reservedFunction = iota
+	notFunction
+	conditionalFunction
 )
+
+// VariadicFunction is a function that accepts any number of arguments.
+// It may return an error if it is given the wrong number of arguments or the arguments are outside of its domain.
+type VariadicFunction func(args ...float64) (float64, error)
@@ -0,0 +1,123 @@
+package expression
+
+import (
+	"math"
+	"testing"
+)
+
+func TestErrorSpans(t *testing.T) {
+	tests := []struct {
+		expression string
+		start      int
+		end        int
+	}{
+		{"2 * (3 + x", 4, 5},
+		{"2 + 3)", 5, 6},
+		{"1 +", 2, 3},
+		{"1 2", 2, 3},
+		{"(1)(2)", 4, 5},
+		{"f(1,,2)", 4, 5},
+		{"1, 2", 1, 2},
+		{"x = 1 = 2; x", 6, 7},
+		{"a = 1;; a", 6, 7},
+		{"1; a", 0, 1},
+		{"if(1, 2)", 0, 8},
+		{"αβ + (", 7, 8},
+		{"y + foo", 4, 7},
+		{"2 * bar(3)", 4, 10},
+		{"a = 1; a + b", 11, 12},
+		{"2 * sin(1, 2)", 4, 13},
+		{"3 + max()", 4, 9},
+	}
+
+	for _, test := range tests {
+		expr, err := GetExpression(test.expression)
+		if err == nil {
+			expr.SetVariables(map[string]float64{"y": 1})
+			expr.SetFunctions(map[string]func(float64) float64{"sin": math.Sin})
+			expr.SetVariadicFunctions(StandardVariadicFunctions())
+			_, err = expr.Eval()
+		}
+		if err == nil {
+			t.Errorf("Expected an error for %s but got nothing.", test.expression)
+			continue
+		}
+
+		syntaxError, ok := err.(SyntaxError)
+		if !ok {
+			t.Errorf("Expected a SyntaxError for %s but got %T", test.expression, err)
+			continue
+		}
+		if syntaxError.Position != test.start || syntaxError.End != test.end {
+			t.Errorf("Expected the error %s for %s to span %d to %d but got %d to %d",
+				syntaxError.Description, test.expression, test.start, test.end, syntaxError.Position, syntaxError.End)
+		}
+	}
+}
+
+func TestErrorSpanInDefinedFunction(t *testing.T) {
+	expr, err := GetExpression("1 + f(2)")
+	if err != nil {
+		t.Fatalf("Unexpected Error\n%s", err)
+	}
+	if err := expr.Define("f(x) = x*k"); err != nil {
+		t.Fatalf("Problem defining f, %s", err)
+	}
+
+	_, err = expr.Eval()
+	syntaxError, ok := err.(SyntaxError)
+	if !ok {
+		t.Fatalf("Expected a SyntaxError but got %v", err)
+	}
+	if syntaxError.Position != 4 || syntaxError.End != 8 {
+		t.Errorf("Expected the error to be at the call of f but got %d to %d", syntaxError.Position, syntaxError.End)
+	}
+}
+
+func TestErrorWithoutSpan(t *testing.T) {
+	expr := NewExpression(&VariableNode{Name: "x"})
+	expr.SetVariables(nil)
+
+	_, err := expr.Eval()
+	syntaxError, ok := err.(SyntaxError)
+	if !ok {
+		t.Fatalf("Expected a SyntaxError but got %v", err)
+	}
+	if syntaxError.Snippet("x") != "" {
+		t.Errorf("Expected no snippet for an error without a position but got %q", syntaxError.Snippet("x"))
+	}
+	if syntaxError.Error() != syntaxError.Description {
+		t.Errorf("Expected the error without a position to be just the description but got %s", syntaxError.Error())
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	tests := []struct {
+		expression string
+		snippet    string
+	}{
+		{"2 * (3 + x", "2 * (3 + x\n    ^"},
+		{"y + foo", "y + foo\n    ^^^"},
+		{"1e", "1e\n  ^"},
+		{"αβ + (", "αβ + (\n     ^"},
+		{"a = 2;\nb = (a;\nb", "b = (a;\n    ^"},
+		{"\t1 +", "\t1 +\n\t  ^"},
+	}
+
+	for _, test := range tests {
+		expr, err := GetExpression(test.expression)
+		if err == nil {
+			expr.SetVariables(map[string]float64{"y": 1})
+			_, err = expr.Eval()
+		}
+
+		syntaxError, ok := err.(SyntaxError)
+		if !ok {
+			t.Errorf("Expected a SyntaxError for %s but got %v", test.expression, err)
+			continue
+		}
+		if snippet := syntaxError.Snippet(test.expression); snippet != test.snippet {
+			t.Errorf("Unexpected snippet for %s, expected\n%s\nbut got\n%s", test.expression, test.snippet, snippet)
+		}
+	}
+}
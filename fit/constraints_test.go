@@ -0,0 +1,158 @@
+package fit
+
+import (
+	"math"
+	"testing"
+
+	"github.com/corwinkuiper/expression/expression"
+)
+
+func TestFitBounds(t *testing.T) {
+
+	// the best unconstrained fit has a negative intercept
+	data := []DataElement{
+		{X: 1, Y: 1},
+		{X: 2, Y: 3},
+		{X: 3, Y: 5},
+		{X: 4, Y: 7},
+	}
+
+	for name, fit := range map[string]func([]DataElement, *expression.Expression, *Options) (*FitResult, error){
+		"LeastSquares":       LeastSquares,
+		"LevenbergMarquardt": LevenbergMarquardt,
+	} {
+		expr, e := expression.GetExpression("A*x + B")
+		if e != nil {
+			t.Fatalf("Could not get expression, %s", e)
+		}
+
+		result, e := fit(data, expr, &Options{
+			Bounds: map[string]Bounds{
+				"B": {Lower: 0, Upper: math.Inf(1)},
+			},
+		})
+		if e != nil {
+			t.Fatalf("%s errored, %s", name, e)
+		}
+
+		// with B held at 0 the best slope is Σxy/Σx²
+		if math.Abs(result.Parameters["B"]) > 1e-9 {
+			t.Errorf("%s: expected B to be held at its bound of 0 but got %f", name, result.Parameters["B"])
+		}
+		if math.Abs(result.Parameters["A"]-50.0/30) > 1e-4 {
+			t.Errorf("%s: expected A to be %f but got %f", name, 50.0/30, result.Parameters["A"])
+		}
+	}
+}
+
+func TestFitBoundsInitialValue(t *testing.T) {
+
+	var data []DataElement
+	for i := 0; i < 10; i++ {
+		x := float64(i)
+		data = append(data, DataElement{
+			X: x,
+			Y: 2 * math.Exp(-0.5*x),
+		})
+	}
+
+	expr, e := expression.GetExpression("A*exp(-k*x)")
+	if e != nil {
+		t.Fatalf("Could not get expression, %s", e)
+	}
+	expr.SetFunctions(map[string]func(float64) float64{
+		"exp": math.Exp,
+	})
+
+	// the rate starts outside of its bounds and is moved inside them
+	result, e := LevenbergMarquardt(data, expr, &Options{
+		Initial: map[string]float64{
+			"A": 1,
+			"k": -3,
+		},
+		Bounds: map[string]Bounds{
+			"k": {Lower: 0.1, Upper: 10},
+		},
+	})
+	if e != nil {
+		t.Fatalf("Fit errored, %s", e)
+	}
+
+	expectParameters(t, result.Parameters, map[string]float64{
+		"A": 2,
+		"k": 0.5,
+	}, 1e-6)
+}
+
+func TestFitFixedParameters(t *testing.T) {
+
+	data := []DataElement{
+		{X: 0, Y: 1.5},
+		{X: 1, Y: 3.5},
+		{X: 2, Y: 5.5},
+		{X: 3, Y: 7.5},
+	}
+
+	expr, e := expression.GetExpression("A*x + B")
+	if e != nil {
+		t.Fatalf("Could not get expression, %s", e)
+	}
+
+	result, e := LevenbergMarquardt(data, expr, &Options{
+		Fixed: map[string]float64{
+			"A": 2,
+		},
+	})
+	if e != nil {
+		t.Fatalf("Fit errored, %s", e)
+	}
+
+	expectParameters(t, result.Parameters, map[string]float64{
+		"A": 2,
+		"B": 1.5,
+	}, 1e-9)
+
+	if len(result.ParameterNames) != 1 || result.ParameterNames[0] != "B" {
+		t.Errorf("Expected only B to be fitted but got %v", result.ParameterNames)
+	}
+	if result.StandardErrors["A"] != 0 {
+		t.Errorf("Expected the fixed parameter to have no error but got %f", result.StandardErrors["A"])
+	}
+	if result.DegreesOfFreedom != 3 {
+		t.Errorf("Expected 3 degrees of freedom but got %d", result.DegreesOfFreedom)
+	}
+	if expr.Variables()["A"] != 2 {
+		t.Errorf("Expected the expression to hold the fixed value but got %f", expr.Variables()["A"])
+	}
+}
+
+func TestFitBadConstraints(t *testing.T) {
+
+	tests := map[string]Options{
+		"bounds of an unknown parameter": {
+			Bounds: map[string]Bounds{"C": {Lower: 0, Upper: 1}},
+		},
+		"bounds of a fixed parameter": {
+			Fixed:  map[string]float64{"A": 1},
+			Bounds: map[string]Bounds{"A": {Lower: 0, Upper: 1}},
+		},
+		"inverted bounds": {
+			Bounds: map[string]Bounds{"A": {Lower: 1, Upper: 0}},
+		},
+		"unknown fixed parameter": {
+			Fixed: map[string]float64{"C": 1},
+		},
+	}
+
+	for name, options := range tests {
+		expr, e := expression.GetExpression("A*x + B")
+		if e != nil {
+			t.Fatalf("Could not get expression, %s", e)
+		}
+
+		options := options
+		if _, e := LevenbergMarquardt(linearData, expr, &options); e == nil {
+			t.Errorf("Expected an error for %s but got nothing.", name)
+		}
+	}
+}
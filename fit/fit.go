@@ -1,108 +1,110 @@
 package fit
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/corwinkuiper/expression/expression"
-	"math"
 )
 
-const dependent = "x"
+const defaultIndependent = "x"
 const iterationCount = 5000
 
+// DataElement is a measurement of Y at a point.
+// For a single independent variable the point is X, otherwise Inputs holds the value of each independent variable by name.
+// X is used for the first independent variable if Inputs doesn't contain it.
+// Sigma is the uncertainty in Y, the point is weighted by 1/Sigma² unless it is 0 which gives a weight of 1.
 type DataElement struct {
-	X float64
-	Y float64
+	X      float64
+	Y      float64
+	Sigma  float64
+	Inputs map[string]float64
 }
 
-func LeastSquares(data []DataElement, expr *expression.Expression) (map[string]float64, error) {
+// LeastSquares fits the expression to the data using steepest descent on the sum of the squared residuals.
+// Every variable except the independent variables, x by default, is a parameter.
+// The fit starts from and updates the variables of the expression.
+// Parameters are kept inside their bounds by moving them back onto the bound after each step.
+// Options may be nil to use the defaults.
+func LeastSquares(data []DataElement, expr *expression.Expression, options *Options) (*FitResult, error) {
+	return fitExpression(data, expr, options, iterationCount, steepestDescent)
+}
 
-	VariableValues := expr.Variables()
+// minimiser finds the parameters that minimise the sum of the squared residuals of the model starting from the parameters given.
+type minimiser func(m *model, params []float64, o *Options) (solution, error)
 
-	// want to differentiate leastSquaresResidualFunction on every variable except "dependent".
+func fitExpression(data []DataElement, expr *expression.Expression, options *Options, maxIterations int, minimise minimiser) (*FitResult, error) {
+	return fitDatasets([]Dataset{{Data: data, Expression: expr}}, unqualified, options, maxIterations, minimise)
+}
 
-	for i := 0; i < iterationCount; i++ {
-		differentials := map[string]float64{}
-		for key := range VariableValues {
-			if key == dependent {
-				continue
-			}
-			r, e := differentiateLeastSquaresFunction(data, expr, key)
-			if e != nil {
-				return nil, e
-			}
+func fitDatasets(datasets []Dataset, qualify func(name string, set int) string, options *Options, maxIterations int, minimise minimiser) (*FitResult, error) {
 
-			differentials[key] = r
-		}
+	o := options.withDefaults(maxIterations)
 
-		for key, diff := range differentials {
-			//fmt.Println(key, VariableValues[key], diff)
-			VariableValues[key] = VariableValues[key] - diff / 100
-		}
+	m, err := newModel(datasets, qualify, &o)
+	if err != nil {
+		return nil, err
 	}
 
-	fitVars := map[string]float64{}
-
-	for key, value := range VariableValues {
-		if key == dependent {
-			continue
-		}
-		fitVars[key] = value
+	if m.count() == 0 {
+		return nil, errors.New("there is no data to fit")
 	}
-
-	return fitVars, nil
-}
-
-func differentiateLeastSquaresFunction(data []DataElement, expr *expression.Expression, variableName string) (float64, error) {
-
-	vars := expr.Variables()
-	epsilon := math.Nextafter(1.0, 2.0) - 1.0
-
-	x := vars[variableName]
-	h := 0.000001
-
-	if h == 0 {
-		h = epsilon
+	// with fewer points than parameters the parameters can't all be determined, so the fit would mean nothing
+	if m.count() < len(m.parameters) {
+		return nil, fmt.Errorf("%d data points are too few to fit %d parameters", m.count(), len(m.parameters))
 	}
 
-	xForward := x + h
-	xBackward := x - h
-	dx := xForward - xBackward
-
-	vars[variableName] = xForward
-	result1, err := leastSquaresResidualFunction(data, expr)
-	if err != nil {
-		return 0, err
+	if o.Loss != LinearLoss {
+		minimise = reweighted(minimise)
 	}
 
-	vars[variableName] = xBackward
-	result2, err := leastSquaresResidualFunction(data, expr)
+	s, err := minimise(m, append([]float64{}, m.start...), &o)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	vars[variableName] = x
+	m.store(s.params)
+	return newResult(m, s, o.AbsoluteSigma)
+}
 
-	return (result2 - result1) / dx, nil
+func steepestDescent(m *model, params []float64, o *Options) (solution, error) {
 
-}
+	r := make([]float64, m.count())
+	jac := newMatrix(m.count(), len(params))
+	step := make([]float64, len(params))
+	previous := make([]float64, len(params))
 
-func leastSquaresResidualFunction(data []DataElement, expr *expression.Expression) (float64, error) {
+	if err := m.residuals(params, r); err != nil {
+		return solution{}, err
+	}
+	current := cost(r)
 
-	v := expr.Variables()
+	for i := 1; i <= o.MaxIterations; i++ {
+		if err := m.jacobian(params, jac); err != nil {
+			return solution{}, err
+		}
 
-	x := v[dependent]
+		// the derivative of the sum of the squared residuals is -2 Jᵀr
+		_, g := normalEquations(jac, r, len(params))
+		copy(previous, params)
+		for j := range params {
+			params[j] = params[j] + 2*o.StepSize*g[j]
+		}
+		m.clamp(params)
+		for j := range params {
+			step[j] = params[j] - previous[j]
+		}
 
-	sum := 0.0
+		if err := m.residuals(params, r); err != nil {
+			return solution{}, err
+		}
+		next := cost(r)
 
-	for _, d := range data {
-		v[dependent] = d.X
-		y, err := expr.Eval()
-		if err != nil {
-			return 0, err
+		if o.converged(current, next, step, params) {
+			return solution{params, i, true}, nil
 		}
-		sum += math.Pow(d.Y-y, 2)
+		current = next
 	}
 
-	v[dependent] = x
-
-	return -sum, nil
+	return solution{params, o.MaxIterations, false}, nil
 }
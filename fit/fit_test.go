@@ -37,15 +37,136 @@ func TestLeastSquares(t *testing.T) {
 		t.Fatalf("Could not get expression, %s", e)
 	}
 
-	a, e := LeastSquares(data, expr)
+	a, e := LeastSquares(data, expr, nil)
 	if e != nil {
 		t.Fatalf("Fit errored, %s", e)
 	}
 
-	if math.Round(a["A"]*accuracy)/accuracy != 2 {
-		t.Fatalf("Incorrect value of A calculated, expected 2 but got %f", a["A"])
+	if math.Round(a.Parameters["A"]*accuracy)/accuracy != 2 {
+		t.Fatalf("Incorrect value of A calculated, expected 2 but got %f", a.Parameters["A"])
 	}
-	if math.Round(a["B"]*accuracy)/accuracy != 1 {
-		t.Fatalf("Incorrect value of B calculated, expected 1 but got %f", a["A"])
+	if math.Round(a.Parameters["B"]*accuracy)/accuracy != 1 {
+		t.Fatalf("Incorrect value of B calculated, expected 1 but got %f", a.Parameters["A"])
+	}
+}
+
+func TestLeastSquaresNumericGradient(t *testing.T) {
+
+	const accuracy = 10000
+
+	data := []DataElement{
+		{X: 0, Y: 1},
+		{X: 1, Y: 3},
+		{X: 2, Y: 5},
+		{X: 3, Y: 7},
+		{X: 4, Y: 9},
+	}
+
+	// the derivative of identity isn't known so this has to fall back to numeric differentiation
+	expr, e := expression.GetExpression("identity(A*x) + B")
+	if e != nil {
+		t.Fatalf("Could not get expression, %s", e)
+	}
+
+	expr.SetFunctions(map[string]func(float64) float64{
+		"identity": func(v float64) float64 {
+			return v
+		},
+	})
+
+	a, e := LeastSquares(data, expr, nil)
+	if e != nil {
+		t.Fatalf("Fit errored, %s", e)
+	}
+
+	if math.Round(a.Parameters["A"]*accuracy)/accuracy != 2 {
+		t.Fatalf("Incorrect value of A calculated, expected 2 but got %f", a.Parameters["A"])
+	}
+	if math.Round(a.Parameters["B"]*accuracy)/accuracy != 1 {
+		t.Fatalf("Incorrect value of B calculated, expected 1 but got %f", a.Parameters["B"])
+	}
+}
+
+func TestFitNamedIndependentVariable(t *testing.T) {
+
+	var data []DataElement
+	for i := 0; i < 10; i++ {
+		time := float64(i)
+		data = append(data, DataElement{
+			X: time,
+			Y: 4 - 9.8*time*time/2,
+		})
+	}
+
+	expr, e := expression.GetExpression("h - g*t^2/2")
+	if e != nil {
+		t.Fatalf("Could not get expression, %s", e)
+	}
+
+	result, e := LevenbergMarquardt(data, expr, &Options{
+		Independent: []string{"t"},
+	})
+	if e != nil {
+		t.Fatalf("Fit errored, %s", e)
+	}
+
+	expectParameters(t, result.Parameters, map[string]float64{
+		"h": 4,
+		"g": 9.8,
+	}, 1e-9)
+}
+
+func TestFitSurface(t *testing.T) {
+
+	var data []DataElement
+	for i := 0; i < 5; i++ {
+		for j := 0; j < 5; j++ {
+			x, y := float64(i), float64(j)
+			data = append(data, DataElement{
+				Y: 2*x - 3*y + 0.5,
+				Inputs: map[string]float64{
+					"x": x,
+					"y": y,
+				},
+			})
+		}
+	}
+
+	expr, e := expression.GetExpression("a*x + b*y + c")
+	if e != nil {
+		t.Fatalf("Could not get expression, %s", e)
+	}
+
+	result, e := LevenbergMarquardt(data, expr, &Options{
+		Independent: []string{"x", "y"},
+	})
+	if e != nil {
+		t.Fatalf("Fit errored, %s", e)
+	}
+
+	expectParameters(t, result.Parameters, map[string]float64{
+		"a": 2,
+		"b": -3,
+		"c": 0.5,
+	}, 1e-9)
+}
+
+func TestFitMissingInput(t *testing.T) {
+
+	data := []DataElement{
+		{X: 1, Y: 1, Inputs: map[string]float64{"y": 1}},
+		{X: 2, Y: 2},
+	}
+
+	expr, e := expression.GetExpression("a*x + b*y")
+	if e != nil {
+		t.Fatalf("Could not get expression, %s", e)
+	}
+
+	_, e = LeastSquares(data, expr, &Options{
+		Independent: []string{"x", "y"},
+	})
+	if e == nil {
+		t.Fatal("Expected an error but got nothing.")
 	}
 }
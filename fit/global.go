@@ -0,0 +1,42 @@
+package fit
+
+import (
+	"fmt"
+
+	"github.com/corwinkuiper/expression/expression"
+)
+
+// Dataset is data fitted by an expression as part of a global fit.
+type Dataset struct {
+	Data       []DataElement
+	Expression *expression.Expression
+}
+
+// GlobalFit fits several datasets at once using the Levenberg-Marquardt algorithm, each with its own expression.
+// Parameters named in shared take the same value in every dataset, eg. a decay rate common to several runs.
+// Every other parameter is local to its dataset and is named name[i] in the result, where i is the index of the dataset.
+// Initial values, bounds and fixed values in the options can be given for a local parameter of one dataset as name[i],
+// or for that parameter in every dataset as just name.
+// The fit starts from and updates the variables of every expression.
+func GlobalFit(datasets []Dataset, shared []string, options *Options) (*FitResult, error) {
+
+	for _, name := range shared {
+		found := false
+		for _, dataset := range datasets {
+			_, ok := dataset.Expression.Variables()[name]
+			found = found || ok
+		}
+		if !found {
+			return nil, fmt.Errorf("shared parameter %s is not in any of the expressions", name)
+		}
+	}
+
+	qualify := func(name string, set int) string {
+		if indexOf(shared, name) >= 0 {
+			return name
+		}
+		return fmt.Sprintf("%s[%d]", name, set)
+	}
+
+	return fitDatasets(datasets, qualify, options, levenbergIterationCount, levenbergMarquardt)
+}
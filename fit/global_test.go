@@ -0,0 +1,124 @@
+package fit
+
+import (
+	"math"
+	"testing"
+
+	"github.com/corwinkuiper/expression/expression"
+)
+
+func decayDataset(t *testing.T, amplitude float64, rate float64, offset float64) Dataset {
+	t.Helper()
+
+	var data []DataElement
+	for i := 0; i < 15; i++ {
+		x := float64(i) / 3
+		data = append(data, DataElement{
+			X: x,
+			Y: amplitude*math.Exp(-rate*x) + offset,
+		})
+	}
+
+	expr, e := expression.GetExpression("A*exp(-k*x) + C")
+	if e != nil {
+		t.Fatalf("Could not get expression, %s", e)
+	}
+	expr.SetFunctions(map[string]func(float64) float64{
+		"exp": math.Exp,
+	})
+
+	return Dataset{
+		Data:       data,
+		Expression: expr,
+	}
+}
+
+func TestGlobalFit(t *testing.T) {
+
+	datasets := []Dataset{
+		decayDataset(t, 5, 0.8, 0.2),
+		decayDataset(t, 2, 0.8, -0.1),
+		decayDataset(t, 7, 0.8, 0),
+	}
+
+	result, e := GlobalFit(datasets, []string{"k"}, &Options{
+		Initial: map[string]float64{
+			"A": 1,
+			"k": 0.1,
+		},
+	})
+	if e != nil {
+		t.Fatalf("Fit errored, %s", e)
+	}
+
+	expectParameters(t, result.Parameters, map[string]float64{
+		"k":    0.8,
+		"A[0]": 5,
+		"C[0]": 0.2,
+		"A[1]": 2,
+		"C[1]": -0.1,
+		"A[2]": 7,
+		"C[2]": 0,
+	}, 1e-6)
+
+	if result.DegreesOfFreedom != 45-7 {
+		t.Errorf("Expected %d degrees of freedom but got %d", 45-7, result.DegreesOfFreedom)
+	}
+
+	if v := datasets[1].Expression.Variables()["A"]; math.Abs(v-2) > 1e-6 {
+		t.Errorf("Expected the expression of the second dataset to have A = 2 but got %f", v)
+	}
+}
+
+func TestGlobalFitDifferentExpressions(t *testing.T) {
+
+	line := Dataset{
+		Data: []DataElement{
+			{X: 0, Y: 1},
+			{X: 1, Y: 3},
+			{X: 2, Y: 5},
+		},
+	}
+	parabola := Dataset{
+		Data: []DataElement{
+			{X: 0, Y: -1},
+			{X: 1, Y: 1},
+			{X: 2, Y: 7},
+			{X: 3, Y: 17},
+		},
+	}
+
+	var e error
+	line.Expression, e = expression.GetExpression("m*x + c")
+	if e != nil {
+		t.Fatalf("Could not get expression, %s", e)
+	}
+	parabola.Expression, e = expression.GetExpression("m*x^2 + c")
+	if e != nil {
+		t.Fatalf("Could not get expression, %s", e)
+	}
+
+	// the slope is shared and the intercepts are not
+	result, e := GlobalFit([]Dataset{line, parabola}, []string{"m"}, &Options{
+		Fixed: map[string]float64{
+			"c[1]": -1,
+		},
+	})
+	if e != nil {
+		t.Fatalf("Fit errored, %s", e)
+	}
+
+	expectParameters(t, result.Parameters, map[string]float64{
+		"m":    2,
+		"c[0]": 1,
+		"c[1]": -1,
+	}, 1e-9)
+}
+
+func TestGlobalFitUnknownSharedParameter(t *testing.T) {
+
+	_, e := GlobalFit([]Dataset{decayDataset(t, 5, 0.8, 0)}, []string{"rate"}, nil)
+	if e == nil {
+		t.Fatal("Expected an error but got nothing.")
+	}
+}
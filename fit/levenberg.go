@@ -0,0 +1,120 @@
+package fit
+
+import (
+	"errors"
+	"math"
+
+	"github.com/corwinkuiper/expression/expression"
+)
+
+const levenbergIterationCount = 1000
+
+const initialDamping = 1e-3
+const maximumDamping = 1e16
+
+// LevenbergMarquardt fits the expression to the data using the Levenberg-Marquardt algorithm.
+// Every variable except the independent variables, x by default, is a parameter.
+// The fit starts from and updates the variables of the expression.
+// It stops once the sum of the squared residuals or the parameters stop changing,
+// or without converging if no step reduces the residuals.
+// Options may be nil to use the defaults.
+func LevenbergMarquardt(data []DataElement, expr *expression.Expression, options *Options) (*FitResult, error) {
+	return fitExpression(data, expr, options, levenbergIterationCount, levenbergMarquardt)
+}
+
+func levenbergMarquardt(m *model, params []float64, o *Options) (solution, error) {
+
+	n := len(params)
+
+	r := make([]float64, m.count())
+	jac := newMatrix(m.count(), n)
+
+	if err := m.residuals(params, r); err != nil {
+		return solution{}, err
+	}
+	current := cost(r)
+	if math.IsNaN(current) || math.IsInf(current, 0) {
+		return solution{}, errors.New("the initial parameters don't give a finite residual")
+	}
+
+	damping := initialDamping
+	trial := make([]float64, n)
+
+	for i := 1; i <= o.MaxIterations; i++ {
+		if err := m.jacobian(params, jac); err != nil {
+			return solution{}, err
+		}
+		// an infinite or NaN derivative gives no direction to step in, so it can't be taken for a minimum
+		for _, row := range jac {
+			for _, d := range row {
+				if math.IsNaN(d) || math.IsInf(d, 0) {
+					return solution{}, errors.New("the derivative of the residuals isn't finite at the parameters")
+				}
+			}
+		}
+		a, g := normalEquations(jac, r, n)
+
+		// parameters on a bound that the step would push past are held still
+		for j := range g {
+			if (params[j] <= m.lower[j] && g[j] < 0) || (params[j] >= m.upper[j] && g[j] > 0) {
+				for k := range a {
+					a[j][k], a[k][j] = 0, 0
+				}
+				a[j][j] = 1
+				g[j] = 0
+			}
+		}
+
+		for {
+			damped := newMatrix(n, n)
+			for j := range a {
+				copy(damped[j], a[j])
+				// scale the damping by the curvature so every parameter is damped in proportion
+				if a[j][j] != 0 {
+					damped[j][j] += damping * a[j][j]
+				} else {
+					damped[j][j] += damping
+				}
+			}
+
+			step, err := solve(damped, g)
+			if err == nil {
+				copy(trial, params)
+				for j := range trial {
+					trial[j] += step[j]
+				}
+				// steps that leave the bounds are cut short at the bound
+				m.clamp(trial)
+				for j := range step {
+					step[j] = trial[j] - params[j]
+				}
+
+				if err := m.residuals(trial, r); err != nil {
+					return solution{}, err
+				}
+
+				if next := cost(r); next <= current {
+					copy(params, trial)
+					damping = math.Max(damping/10, 1e-15)
+
+					if o.converged(current, next, step, params) {
+						return solution{params, i, true}, nil
+					}
+					current = next
+					break
+				}
+			}
+
+			damping *= 10
+			if damping > maximumDamping {
+				// no step reduces the residuals, so the fit has stalled rather than converged
+				if err := m.residuals(params, r); err != nil {
+					return solution{}, err
+				}
+				return solution{params, i, false}, nil
+			}
+		}
+	}
+
+	return solution{params, o.MaxIterations, false}, nil
+}
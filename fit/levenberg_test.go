@@ -0,0 +1,255 @@
+package fit
+
+import (
+	"math"
+	"testing"
+
+	"github.com/corwinkuiper/expression/expression"
+)
+
+func TestLevenbergMarquardtLinear(t *testing.T) {
+
+	data := []DataElement{
+		{X: 0, Y: 1},
+		{X: 1, Y: 3},
+		{X: 2, Y: 5},
+		{X: 3, Y: 7},
+		{X: 4, Y: 9},
+	}
+
+	expr, e := expression.GetExpression("A*x + B")
+	if e != nil {
+		t.Fatalf("Could not get expression, %s", e)
+	}
+
+	a, e := LevenbergMarquardt(data, expr, nil)
+	if e != nil {
+		t.Fatalf("Fit errored, %s", e)
+	}
+
+	expectParameters(t, a.Parameters, map[string]float64{
+		"A": 2,
+		"B": 1,
+	}, 1e-9)
+
+	if expr.Variables()["A"] != a.Parameters["A"] {
+		t.Errorf("Expected the expression to be updated with the fitted parameters")
+	}
+}
+
+func TestLevenbergMarquardtExponentialDecay(t *testing.T) {
+
+	var data []DataElement
+	for i := 0; i < 20; i++ {
+		x := float64(i) / 2
+		data = append(data, DataElement{
+			X: x,
+			Y: 5*math.Exp(-0.7*x) + 0.5,
+		})
+	}
+
+	expr, e := expression.GetExpression("A*exp(-k*x) + C")
+	if e != nil {
+		t.Fatalf("Could not get expression, %s", e)
+	}
+
+	expr.SetFunctions(map[string]func(float64) float64{
+		"exp": math.Exp,
+	})
+	expr.SetVariables(map[string]float64{
+		"A": 1,
+		"k": 0.1,
+		"C": 0,
+	})
+
+	a, e := LevenbergMarquardt(data, expr, nil)
+	if e != nil {
+		t.Fatalf("Fit errored, %s", e)
+	}
+
+	expectParameters(t, a.Parameters, map[string]float64{
+		"A": 5,
+		"k": 0.7,
+		"C": 0.5,
+	}, 1e-6)
+}
+
+func TestLevenbergMarquardtGaussian(t *testing.T) {
+
+	var data []DataElement
+	for i := 0; i < 40; i++ {
+		x := float64(i)/4 - 5
+		data = append(data, DataElement{
+			X: x,
+			Y: 3 * math.Exp(-math.Pow(x-1.2, 2)/(2*0.8*0.8)),
+		})
+	}
+
+	// negation binds tighter than powers so the square has to be bracketed
+	expr, e := expression.GetExpression("A*exp(-((x - mu)^2)/(2*s^2))")
+	if e != nil {
+		t.Fatalf("Could not get expression, %s", e)
+	}
+
+	expr.SetFunctions(map[string]func(float64) float64{
+		"exp": math.Exp,
+	})
+	expr.SetVariables(map[string]float64{
+		"A":  1,
+		"mu": 0,
+		"s":  2,
+	})
+
+	a, e := LevenbergMarquardt(data, expr, nil)
+	if e != nil {
+		t.Fatalf("Fit errored, %s", e)
+	}
+
+	expectParameters(t, a.Parameters, map[string]float64{
+		"A":  3,
+		"mu": 1.2,
+		"s":  0.8,
+	}, 1e-6)
+}
+
+func TestLevenbergMarquardtNumericJacobian(t *testing.T) {
+
+	var data []DataElement
+	for i := 0; i < 20; i++ {
+		x := float64(i) / 2
+		data = append(data, DataElement{
+			X: x,
+			Y: 5 * math.Exp(-0.7*x),
+		})
+	}
+
+	// the derivative of decay isn't known so this has to use numeric differentiation
+	expr, e := expression.GetExpression("A*decay(k*x)")
+	if e != nil {
+		t.Fatalf("Could not get expression, %s", e)
+	}
+
+	expr.SetFunctions(map[string]func(float64) float64{
+		"decay": func(v float64) float64 {
+			return math.Exp(-v)
+		},
+	})
+	expr.SetVariables(map[string]float64{
+		"A": 1,
+		"k": 0.1,
+	})
+
+	a, e := LevenbergMarquardt(data, expr, nil)
+	if e != nil {
+		t.Fatalf("Fit errored, %s", e)
+	}
+
+	expectParameters(t, a.Parameters, map[string]float64{
+		"A": 5,
+		"k": 0.7,
+	}, 1e-6)
+}
+
+func expectParameters(t *testing.T, actual map[string]float64, expected map[string]float64, tolerance float64) {
+	t.Helper()
+
+	if len(actual) != len(expected) {
+		t.Errorf("Expected %d parameters but got %d", len(expected), len(actual))
+	}
+
+	for key, value := range expected {
+		if math.Abs(actual[key]-value) > tolerance {
+			t.Errorf("Incorrect value of %s calculated, expected %f but got %f", key, value, actual[key])
+		}
+	}
+}
+
+func TestLevenbergMarquardtPiecewise(t *testing.T) {
+
+	var data []DataElement
+	for x := -3.0; x <= 3; x++ {
+		data = append(data, DataElement{X: x, Y: math.Max(0, 1.5*x)})
+	}
+
+	expr, e := expression.GetExpression("if(x < 0, 0, k*x)")
+	if e != nil {
+		t.Fatalf("Could not get expression, %s", e)
+	}
+
+	a, e := LevenbergMarquardt(data, expr, nil)
+	if e != nil {
+		t.Fatalf("Fit errored, %s", e)
+	}
+
+	expectParameters(t, a.Parameters, map[string]float64{
+		"k": 1.5,
+	}, 1e-9)
+}
+
+func TestLevenbergMarquardtProgram(t *testing.T) {
+
+	var data []DataElement
+	for x := 0.0; x < 5; x++ {
+		data = append(data, DataElement{X: x, Y: 2 * math.Exp(-0.5*x) * (1 + 2*math.Exp(-0.5*x))})
+	}
+
+	expr, e := expression.GetExpression("d = A*exp(-k*x); d + d^2")
+	if e != nil {
+		t.Fatalf("Could not get expression, %s", e)
+	}
+	expr.SetFunctions(map[string]func(float64) float64{
+		"exp": math.Exp,
+	})
+	expr.SetVariables(map[string]float64{
+		"A": 1,
+		"k": 1,
+	})
+
+	a, e := LevenbergMarquardt(data, expr, nil)
+	if e != nil {
+		t.Fatalf("Fit errored, %s", e)
+	}
+
+	expectParameters(t, a.Parameters, map[string]float64{
+		"A": 2,
+		"k": 0.5,
+	}, 1e-6)
+}
+
+func TestLevenbergMarquardtNonFiniteDerivative(t *testing.T) {
+
+	data := []DataElement{{X: 1, Y: 3}, {X: 2, Y: 5}, {X: 3, Y: 7}}
+
+	expr, e := expression.GetExpression("sqrt(a - 1)*x + b")
+	if e != nil {
+		t.Fatalf("Could not get expression, %s", e)
+	}
+	expr.SetFunctions(map[string]func(float64) float64{
+		"sqrt": math.Sqrt,
+	})
+
+	// the derivative of sqrt(a - 1) is infinite at a = 1
+	_, e = LevenbergMarquardt(data, expr, &Options{Initial: map[string]float64{"a": 1}})
+	if e == nil {
+		t.Fatal("Expected an error but got nothing.")
+	}
+}
+
+func TestLevenbergMarquardtStalled(t *testing.T) {
+
+	data := []DataElement{{X: 0, Y: 0}, {X: 1, Y: 0}}
+
+	// every step down from A = 0 jumps the model up to 2, although the slope there isn't zero
+	expr, e := expression.GetExpression("if(A < 0, 2, A + 1)")
+	if e != nil {
+		t.Fatalf("Could not get expression, %s", e)
+	}
+
+	a, e := LevenbergMarquardt(data, expr, &Options{Initial: map[string]float64{"A": 0}})
+	if e != nil {
+		t.Fatalf("Fit errored, %s", e)
+	}
+	if a.Converged {
+		t.Errorf("Expected the fit to stop without converging when no step reduces the residuals")
+	}
+}
@@ -0,0 +1,212 @@
+package fit
+
+import (
+	"errors"
+	"math"
+)
+
+var errSingular = errors.New("matrix is singular")
+
+func newMatrix(rows int, columns int) [][]float64 {
+	m := make([][]float64, rows)
+	for i := range m {
+		m[i] = make([]float64, columns)
+	}
+	return m
+}
+
+// normalEquations calculates JᵀJ and Jᵀr.
+func normalEquations(jac [][]float64, r []float64, columns int) ([][]float64, []float64) {
+	a := newMatrix(columns, columns)
+	g := make([]float64, columns)
+
+	for i, row := range jac {
+		for j := 0; j < columns; j++ {
+			g[j] += row[j] * r[i]
+			for k := 0; k < columns; k++ {
+				a[j][k] += row[j] * row[k]
+			}
+		}
+	}
+
+	return a, g
+}
+
+// solve solves ax = b using gaussian elimination with partial pivoting.
+// Neither a nor b are modified.
+func solve(a [][]float64, b []float64) ([]float64, error) {
+	n := len(b)
+
+	m := newMatrix(n, n+1)
+	for i := range m {
+		copy(m[i], a[i])
+		m[i][n] = b[i]
+	}
+
+	for column := 0; column < n; column++ {
+		pivot := column
+		for row := column + 1; row < n; row++ {
+			if math.Abs(m[row][column]) > math.Abs(m[pivot][column]) {
+				pivot = row
+			}
+		}
+		if m[pivot][column] == 0 {
+			return nil, errSingular
+		}
+		m[column], m[pivot] = m[pivot], m[column]
+
+		for row := column + 1; row < n; row++ {
+			factor := m[row][column] / m[column][column]
+			for k := column; k <= n; k++ {
+				m[row][k] -= factor * m[column][k]
+			}
+		}
+	}
+
+	x := make([]float64, n)
+	for row := n - 1; row >= 0; row-- {
+		sum := m[row][n]
+		for k := row + 1; k < n; k++ {
+			sum -= m[row][k] * x[k]
+		}
+		x[row] = sum / m[row][row]
+	}
+
+	return x, nil
+}
+
+// invert finds the inverse of the square matrix a using Gauss-Jordan elimination.
+// a is not modified.
+func invert(a [][]float64) ([][]float64, error) {
+	n := len(a)
+
+	m := newMatrix(n, 2*n)
+	for i := range m {
+		copy(m[i], a[i])
+		m[i][n+i] = 1
+	}
+
+	for column := 0; column < n; column++ {
+		pivot := column
+		for row := column + 1; row < n; row++ {
+			if math.Abs(m[row][column]) > math.Abs(m[pivot][column]) {
+				pivot = row
+			}
+		}
+		if m[pivot][column] == 0 {
+			return nil, errSingular
+		}
+		m[column], m[pivot] = m[pivot], m[column]
+
+		scale := m[column][column]
+		for k := range m[column] {
+			m[column][k] /= scale
+		}
+
+		for row := 0; row < n; row++ {
+			if row == column {
+				continue
+			}
+			factor := m[row][column]
+			for k := range m[row] {
+				m[row][k] -= factor * m[column][k]
+			}
+		}
+	}
+
+	inverse := newMatrix(n, n)
+	for i := range inverse {
+		copy(inverse[i], m[i][n:])
+	}
+	return inverse, nil
+}
+
+// nullSpace finds a basis of the vectors x with ax = 0 using Gauss-Jordan elimination, which is empty if a is invertible.
+// a is not modified.
+func nullSpace(a [][]float64) [][]float64 {
+	n := len(a)
+
+	m := newMatrix(n, n)
+	for i := range m {
+		copy(m[i], a[i])
+	}
+
+	// the column of the pivot of each row that has one
+	var pivots []int
+	for column := 0; column < n && len(pivots) < n; column++ {
+		row := len(pivots)
+		pivot := row
+		for r := row + 1; r < n; r++ {
+			if math.Abs(m[r][column]) > math.Abs(m[pivot][column]) {
+				pivot = r
+			}
+		}
+		if m[pivot][column] == 0 {
+			continue
+		}
+		m[row], m[pivot] = m[pivot], m[row]
+
+		scale := m[row][column]
+		for k := range m[row] {
+			m[row][k] /= scale
+		}
+		for r := 0; r < n; r++ {
+			if r == row {
+				continue
+			}
+			factor := m[r][column]
+			for k := range m[r] {
+				m[r][k] -= factor * m[row][k]
+			}
+		}
+		pivots = append(pivots, column)
+	}
+
+	isPivot := make([]bool, n)
+	for _, column := range pivots {
+		isPivot[column] = true
+	}
+
+	// each column without a pivot can be set freely, fixing the columns with pivots
+	var basis [][]float64
+	for free := 0; free < n; free++ {
+		if isPivot[free] {
+			continue
+		}
+		v := make([]float64, n)
+		v[free] = 1
+		for row, column := range pivots {
+			v[column] = -m[row][free]
+		}
+		basis = append(basis, v)
+	}
+	return basis
+}
+
+// orthonormalise turns the vectors into an orthonormal basis of the space they span using the Gram-Schmidt process.
+// The vectors must be linearly independent.
+func orthonormalise(vectors [][]float64) [][]float64 {
+	var basis [][]float64
+	for _, v := range vectors {
+		u := append([]float64{}, v...)
+		for _, b := range basis {
+			dot := 0.0
+			for i := range u {
+				dot += u[i] * b[i]
+			}
+			for i := range u {
+				u[i] -= dot * b[i]
+			}
+		}
+		length := 0.0
+		for _, x := range u {
+			length += x * x
+		}
+		length = math.Sqrt(length)
+		for i := range u {
+			u[i] /= length
+		}
+		basis = append(basis, u)
+	}
+	return basis
+}
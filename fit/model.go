@@ -0,0 +1,387 @@
+package fit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/corwinkuiper/expression/expression"
+)
+
+// bound is a compiled expression whose variables are taken from positions in a vector.
+type bound struct {
+	compiled  *expression.Compiled
+	positions []int
+	values    []float64
+}
+
+func bind(expr *expression.Expression, position func(name string) int) (*bound, error) {
+
+	compiled, err := expr.Compile()
+	if err != nil {
+		return nil, err
+	}
+
+	b := &bound{
+		compiled: compiled,
+		values:   make([]float64, len(compiled.Names())),
+	}
+
+	for _, name := range compiled.Names() {
+		p := position(name)
+		if p < 0 {
+			return nil, errors.New("variable " + name + " is neither a parameter nor an independent variable")
+		}
+		b.positions = append(b.positions, p)
+	}
+
+	return b, nil
+}
+
+func (b *bound) eval(vector []float64) (float64, error) {
+	for i, position := range b.positions {
+		b.values[i] = vector[position]
+	}
+	return b.compiled.Eval(b.values)
+}
+
+// model evaluates the expressions of datasets at every data point for values of their parameters.
+// The variables of the model are the parameters followed by the independent variables and then the fixed parameters.
+// Variables of the expressions are given names in the model by qualify, which lets datasets have their own parameters.
+type model struct {
+	datasets []Dataset
+	qualify  func(name string, set int) string
+	// every data point of the datasets, along with the dataset it belongs to.
+	data  []DataElement
+	owner []int
+
+	parameters  []string
+	fixed       []string
+	independent []string
+	// the starting values of the parameters, taken from the expressions.
+	start []float64
+	// the bounds of each parameter
+	lower []float64
+	upper []float64
+	// the values of the independent variables at each data point.
+	inputs [][]float64
+	// the square roots of the weights of each data point which scale the residuals.
+	scales []float64
+	// the scales given by the data before any robust weights are applied.
+	dataScales []float64
+	functions  []*bound
+	// exact derivatives of the function of each dataset by each parameter, nil if the function doesn't depend on the parameter.
+	derivatives [][]*bound
+	// whether the exact derivatives are all available.
+	exact  bool
+	vector []float64
+}
+
+// unqualified gives every variable of an expression the same name in the model.
+func unqualified(name string, set int) string {
+	return name
+}
+
+func newModel(datasets []Dataset, qualify func(name string, set int) string, o *Options) (*model, error) {
+
+	independent := o.Independent
+
+	m := &model{
+		datasets:    datasets,
+		qualify:     qualify,
+		independent: independent,
+	}
+
+	// plain gives the name of a variable of an expression for each name in the model
+	plain := map[string]string{}
+	initial := map[string]float64{}
+
+	for set, dataset := range datasets {
+		for name, value := range dataset.Expression.Variables() {
+			if indexOf(independent, name) >= 0 {
+				continue
+			}
+
+			qualified := qualify(name, set)
+			if _, ok := plain[qualified]; ok {
+				continue
+			}
+			plain[qualified] = name
+			initial[qualified] = value
+
+			if _, ok := optionKey(o.hasFixed, qualified, name); ok {
+				m.fixed = append(m.fixed, qualified)
+			} else {
+				m.parameters = append(m.parameters, qualified)
+			}
+		}
+	}
+	sort.Strings(m.parameters)
+	sort.Strings(m.fixed)
+
+	var fixedKeys, boundsKeys, initialKeys []string
+	for key := range o.Fixed {
+		fixedKeys = append(fixedKeys, key)
+	}
+	for key := range o.Bounds {
+		boundsKeys = append(boundsKeys, key)
+	}
+	for key := range o.Initial {
+		initialKeys = append(initialKeys, key)
+	}
+
+	if name := unknownName(fixedKeys, m.fixed, plain); name != "" {
+		return nil, errors.New("fixed value given for " + name + " which is not a parameter")
+	}
+	if name := unknownName(boundsKeys, m.parameters, plain); name != "" {
+		return nil, errors.New("bounds given for " + name + " which is not a parameter being fitted")
+	}
+	if name := unknownName(initialKeys, m.parameters, plain); name != "" {
+		return nil, errors.New("initial value given for " + name + " which is not a parameter being fitted")
+	}
+
+	names := append(append([]string{}, m.parameters...), independent...)
+	names = append(names, m.fixed...)
+
+	m.vector = make([]float64, len(names))
+	for i, name := range m.fixed {
+		key, _ := optionKey(o.hasFixed, name, plain[name])
+		m.vector[len(m.parameters)+len(independent)+i] = o.Fixed[key]
+	}
+
+	m.start = make([]float64, len(m.parameters))
+	m.lower = make([]float64, len(m.parameters))
+	m.upper = make([]float64, len(m.parameters))
+	for i, name := range m.parameters {
+		m.start[i] = initial[name]
+		if key, ok := optionKey(o.hasInitial, name, plain[name]); ok {
+			m.start[i] = o.Initial[key]
+		}
+
+		m.lower[i], m.upper[i] = math.Inf(-1), math.Inf(1)
+		if key, ok := optionKey(o.hasBounds, name, plain[name]); ok {
+			b := o.Bounds[key]
+			if b.Lower > b.Upper {
+				return nil, errors.New("the lower bound of " + name + " is above its upper bound")
+			}
+			m.lower[i], m.upper[i] = b.Lower, b.Upper
+		}
+	}
+	m.clamp(m.start)
+
+	for set, dataset := range datasets {
+		for _, d := range dataset.Data {
+			i := len(m.data)
+
+			w, err := o.weight(d)
+			if err != nil {
+				return nil, fmt.Errorf("data point %d: %s", i, err)
+			}
+
+			inputs := make([]float64, len(independent))
+			for j, name := range independent {
+				if v, ok := d.Inputs[name]; ok {
+					inputs[j] = v
+				} else if j == 0 {
+					inputs[j] = d.X
+				} else {
+					return nil, fmt.Errorf("data point %d has no value for %s", i, name)
+				}
+			}
+
+			m.data = append(m.data, d)
+			m.owner = append(m.owner, set)
+			m.scales = append(m.scales, math.Sqrt(w))
+			m.inputs = append(m.inputs, inputs)
+		}
+	}
+	m.dataScales = append([]float64{}, m.scales...)
+
+	m.exact = true
+	for set, dataset := range datasets {
+		position := func(name string) int {
+			if i := indexOf(independent, name); i >= 0 {
+				return len(m.parameters) + i
+			}
+			return indexOf(names, qualify(name, set))
+		}
+
+		function, err := bind(dataset.Expression, position)
+		if err != nil {
+			return nil, err
+		}
+		m.functions = append(m.functions, function)
+
+		derivatives := make([]*bound, len(m.parameters))
+		for j, parameter := range m.parameters {
+			if !m.exact || qualify(plain[parameter], set) != parameter {
+				continue
+			}
+			if _, ok := dataset.Expression.Variables()[plain[parameter]]; !ok {
+				continue
+			}
+
+			derivative, err := dataset.Expression.Derive(plain[parameter])
+			if err != nil {
+				m.exact = false
+				break
+			}
+			derivatives[j], err = bind(derivative, position)
+			if err != nil {
+				m.exact = false
+				break
+			}
+		}
+		m.derivatives = append(m.derivatives, derivatives)
+	}
+
+	return m, nil
+}
+
+// optionKey finds the key for a variable of the model in a map of options, either its name in the model or in its expression.
+func optionKey(has func(key string) bool, qualified string, plain string) (string, bool) {
+	if has(qualified) {
+		return qualified, true
+	}
+	return plain, has(plain)
+}
+
+// unknownName finds a key that isn't one of the names or the name in the expression of one of them.
+func unknownName(keys []string, names []string, plain map[string]string) string {
+	for _, key := range keys {
+		known := false
+		for _, name := range names {
+			known = known || key == name || key == plain[name]
+		}
+		if !known {
+			return key
+		}
+	}
+	return ""
+}
+
+// store sets the variables of the expressions to the parameters and the fixed parameters.
+func (m *model) store(params []float64) {
+	for set, dataset := range m.datasets {
+		variables := dataset.Expression.Variables()
+		for name := range variables {
+			qualified := m.qualify(name, set)
+			if i := indexOf(m.parameters, qualified); i >= 0 {
+				variables[name] = params[i]
+			} else if i := indexOf(m.fixed, qualified); i >= 0 {
+				variables[name] = m.fixedValue(i)
+			}
+		}
+	}
+}
+
+func (m *model) fixedValue(i int) float64 {
+	return m.vector[len(m.vector)-len(m.fixed)+i]
+}
+
+// reweight multiplies the weights of the data points by the weights given, or removes any extra weights if nil.
+func (m *model) reweight(weights []float64) {
+	for i := range m.scales {
+		m.scales[i] = m.dataScales[i]
+		if weights != nil {
+			m.scales[i] *= math.Sqrt(weights[i])
+		}
+	}
+}
+
+// clamp moves the parameters inside their bounds.
+func (m *model) clamp(params []float64) {
+	for j := range params {
+		params[j] = math.Max(m.lower[j], math.Min(m.upper[j], params[j]))
+	}
+}
+
+func (m *model) count() int {
+	return len(m.data)
+}
+
+func (m *model) value(params []float64, i int) (float64, error) {
+	copy(m.vector, params)
+	copy(m.vector[len(params):], m.inputs[i])
+	return m.functions[m.owner[i]].eval(m.vector)
+}
+
+// residuals calculates the difference between the data and the model for every data point scaled by the square root of its weight.
+func (m *model) residuals(params []float64, r []float64) error {
+	for i, d := range m.data {
+		y, err := m.value(params, i)
+		if err != nil {
+			return err
+		}
+		r[i] = m.scales[i] * (d.Y - y)
+	}
+	return nil
+}
+
+// jacobian calculates the derivative of the model by every parameter at every data point scaled by the square root of its weight.
+func (m *model) jacobian(params []float64, jac [][]float64) error {
+
+	if m.exact {
+		for i := range m.data {
+			copy(m.vector, params)
+			copy(m.vector[len(params):], m.inputs[i])
+			for j, derivative := range m.derivatives[m.owner[i]] {
+				if derivative == nil {
+					jac[i][j] = 0
+					continue
+				}
+				v, err := derivative.eval(m.vector)
+				if err != nil {
+					return err
+				}
+				jac[i][j] = m.scales[i] * v
+			}
+		}
+		return nil
+	}
+
+	shifted := append([]float64{}, params...)
+
+	for j, p := range params {
+		h := 1e-6 * math.Max(math.Abs(p), 1)
+
+		for i := range m.data {
+			shifted[j] = p + h
+			forward, err := m.value(shifted, i)
+			if err != nil {
+				return err
+			}
+
+			shifted[j] = p - h
+			backward, err := m.value(shifted, i)
+			if err != nil {
+				return err
+			}
+
+			jac[i][j] = m.scales[i] * (forward - backward) / (2 * h)
+		}
+
+		shifted[j] = p
+	}
+
+	return nil
+}
+
+func indexOf(names []string, name string) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// cost calculates the sum of the squares of the residuals, which is chi squared for weighted residuals.
+func cost(r []float64) float64 {
+	sum := 0.0
+	for _, v := range r {
+		sum += v * v
+	}
+	return sum
+}
@@ -0,0 +1,149 @@
+package fit
+
+import (
+	"errors"
+	"math"
+)
+
+// Options configures a fit. Fields left as zero use their default values, and a nil *Options uses all the defaults.
+type Options struct {
+	// MaxIterations is the most iterations the fit can take before stopping.
+	// Defaults to 5000 for LeastSquares and 1000 for LevenbergMarquardt.
+	MaxIterations int
+
+	// The fit has converged when an iteration changes the sum of the squared residuals by less than
+	// CostAbsoluteTolerance + CostRelativeTolerance * cost.
+	// Default to 1e-30 and 1e-12.
+	CostAbsoluteTolerance float64
+	CostRelativeTolerance float64
+
+	// The fit has also converged when an iteration changes every parameter by less than
+	// ParameterAbsoluteTolerance + ParameterRelativeTolerance * |parameter|.
+	// Default to 1e-12 and 1e-10.
+	ParameterAbsoluteTolerance float64
+	ParameterRelativeTolerance float64
+
+	// StepSize is the multiple of the gradient that steepest descent steps by each iteration, defaults to 0.01.
+	// It is not used by LevenbergMarquardt which picks its own step.
+	StepSize float64
+
+	// Independent are the names of the independent variables whose values are given by the data.
+	// Defaults to just x.
+	Independent []string
+
+	// Weight gives the weight of each data point, overriding the weights from Sigma.
+	// Weights must not be negative.
+	Weight func(DataElement) float64
+
+	// AbsoluteSigma is set when the weights are exactly 1/σ² of the data.
+	// The covariance is then found from the weights alone rather than being scaled by the reduced chi squared.
+	AbsoluteSigma bool
+
+	// Initial are the starting values of the parameters.
+	// Parameters not in the map start from the current value of the variable in the expression.
+	Initial map[string]float64
+
+	// Loss is the function of the residuals to minimise, defaults to LinearLoss for ordinary least squares.
+	// The statistics of the result are calculated using the weights from the loss in the final round of reweighting.
+	Loss Loss
+	// LossScale is the size of residual at which a robust loss starts to reduce its influence.
+	// By default it is estimated from the median absolute deviation of the residuals each round.
+	LossScale float64
+
+	// Bounds constrains parameters to lie between a lower and upper bound.
+	Bounds map[string]Bounds
+
+	// Fixed parameters are held at the value given rather than being fitted.
+	Fixed map[string]float64
+}
+
+// Bounds are the lowest and highest values a parameter may take, use math.Inf for a side without a bound.
+type Bounds struct {
+	Lower float64
+	Upper float64
+}
+
+// withDefaults copies the options, filling in the defaults for any that aren't set.
+func (o *Options) withDefaults(maxIterations int) Options {
+	var options Options
+	if o != nil {
+		options = *o
+	}
+
+	if options.MaxIterations == 0 {
+		options.MaxIterations = maxIterations
+	}
+	if options.CostAbsoluteTolerance == 0 {
+		options.CostAbsoluteTolerance = 1e-30
+	}
+	if options.CostRelativeTolerance == 0 {
+		options.CostRelativeTolerance = 1e-12
+	}
+	if options.ParameterAbsoluteTolerance == 0 {
+		options.ParameterAbsoluteTolerance = 1e-12
+	}
+	if options.ParameterRelativeTolerance == 0 {
+		options.ParameterRelativeTolerance = 1e-10
+	}
+	if options.StepSize == 0 {
+		options.StepSize = 0.01
+	}
+	if len(options.Independent) == 0 {
+		options.Independent = []string{defaultIndependent}
+	}
+
+	return options
+}
+
+// converged checks if an iteration that changed the cost from before to after by taking the step to params is small enough to stop.
+func (o *Options) converged(before float64, after float64, step []float64, params []float64) bool {
+
+	if math.Abs(before-after) <= o.CostAbsoluteTolerance+o.CostRelativeTolerance*after {
+		return true
+	}
+
+	return o.parametersConverged(step, params)
+}
+
+// parametersConverged checks if the step to params changed every parameter by less than the tolerance.
+func (o *Options) parametersConverged(step []float64, params []float64) bool {
+	for j := range step {
+		if math.Abs(step[j]) > o.ParameterAbsoluteTolerance+o.ParameterRelativeTolerance*math.Abs(params[j]) {
+			return false
+		}
+	}
+	return true
+}
+
+// weight gets the weight of the data point.
+func (o *Options) weight(d DataElement) (float64, error) {
+
+	w := 1.0
+	if o.Weight != nil {
+		w = o.Weight(d)
+	} else if d.Sigma < 0 {
+		return 0, errors.New("sigma must not be negative")
+	} else if d.Sigma != 0 {
+		w = 1 / (d.Sigma * d.Sigma)
+	}
+
+	if !(w >= 0) || math.IsInf(w, 0) {
+		return 0, errors.New("weights must be finite and not negative")
+	}
+	return w, nil
+}
+
+func (o *Options) hasFixed(name string) bool {
+	_, ok := o.Fixed[name]
+	return ok
+}
+
+func (o *Options) hasBounds(name string) bool {
+	_, ok := o.Bounds[name]
+	return ok
+}
+
+func (o *Options) hasInitial(name string) bool {
+	_, ok := o.Initial[name]
+	return ok
+}
@@ -0,0 +1,144 @@
+package fit
+
+import (
+	"math"
+	"testing"
+
+	"github.com/corwinkuiper/expression/expression"
+)
+
+var linearData = []DataElement{
+	{X: 0, Y: 1},
+	{X: 1, Y: 3},
+	{X: 2, Y: 5},
+	{X: 3, Y: 7},
+	{X: 4, Y: 9},
+}
+
+func TestLeastSquaresStopsEarly(t *testing.T) {
+
+	expr, e := expression.GetExpression("A*x + B")
+	if e != nil {
+		t.Fatalf("Could not get expression, %s", e)
+	}
+
+	result, e := LeastSquares(linearData, expr, nil)
+	if e != nil {
+		t.Fatalf("Fit errored, %s", e)
+	}
+
+	if !result.Converged || result.Iterations >= iterationCount {
+		t.Fatalf("Expected the fit to converge early but it took %d iterations", result.Iterations)
+	}
+
+	expectParameters(t, result.Parameters, map[string]float64{
+		"A": 2,
+		"B": 1,
+	}, 1e-6)
+}
+
+func TestLeastSquaresMaxIterations(t *testing.T) {
+
+	expr, e := expression.GetExpression("A*x + B")
+	if e != nil {
+		t.Fatalf("Could not get expression, %s", e)
+	}
+
+	result, e := LeastSquares(linearData, expr, &Options{
+		MaxIterations: 10,
+		StepSize:      0.001,
+	})
+	if e != nil {
+		t.Fatalf("Fit errored, %s", e)
+	}
+
+	if result.Converged || result.Iterations != 10 {
+		t.Fatalf("Expected the fit to stop after 10 iterations without converging but it took %d iterations and converged is %t", result.Iterations, result.Converged)
+	}
+}
+
+func TestLeastSquaresLooseTolerance(t *testing.T) {
+
+	expr, e := expression.GetExpression("A*x + B")
+	if e != nil {
+		t.Fatalf("Could not get expression, %s", e)
+	}
+
+	strict, e := LeastSquares(linearData, expr, nil)
+	if e != nil {
+		t.Fatalf("Fit errored, %s", e)
+	}
+
+	expr.SetVariables(map[string]float64{})
+	loose, e := LeastSquares(linearData, expr, &Options{
+		CostRelativeTolerance:      1e-2,
+		ParameterRelativeTolerance: 1e-2,
+	})
+	if e != nil {
+		t.Fatalf("Fit errored, %s", e)
+	}
+
+	if loose.Iterations >= strict.Iterations {
+		t.Fatalf("Expected loose tolerances to stop sooner, took %d iterations compared with %d", loose.Iterations, strict.Iterations)
+	}
+}
+
+func TestLevenbergMarquardtInitialValues(t *testing.T) {
+
+	var data []DataElement
+	for i := 0; i < 40; i++ {
+		x := float64(i)/4 - 5
+		data = append(data, DataElement{
+			X: x,
+			Y: 3 * math.Exp(-math.Pow(x-1.2, 2)/(2*0.8*0.8)),
+		})
+	}
+
+	expr, e := expression.GetExpression("A*exp(-((x - mu)^2)/(2*s^2))")
+	if e != nil {
+		t.Fatalf("Could not get expression, %s", e)
+	}
+
+	expr.SetFunctions(map[string]func(float64) float64{
+		"exp": math.Exp,
+	})
+
+	// starting from the default of 0 gives a width of 0 and so no finite residual
+	if _, e := LevenbergMarquardt(data, expr, nil); e == nil {
+		t.Fatal("Expected an error but got nothing.")
+	}
+
+	result, e := LevenbergMarquardt(data, expr, &Options{
+		Initial: map[string]float64{
+			"A":  1,
+			"mu": 0,
+			"s":  2,
+		},
+	})
+	if e != nil {
+		t.Fatalf("Fit errored, %s", e)
+	}
+
+	expectParameters(t, result.Parameters, map[string]float64{
+		"A":  3,
+		"mu": 1.2,
+		"s":  0.8,
+	}, 1e-6)
+}
+
+func TestUnknownInitialValue(t *testing.T) {
+
+	expr, e := expression.GetExpression("A*x + B")
+	if e != nil {
+		t.Fatalf("Could not get expression, %s", e)
+	}
+
+	_, e = LevenbergMarquardt(linearData, expr, &Options{
+		Initial: map[string]float64{
+			"C": 1,
+		},
+	})
+	if e == nil {
+		t.Fatal("Expected an error but got nothing.")
+	}
+}
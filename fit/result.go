@@ -0,0 +1,136 @@
+package fit
+
+import (
+	"math"
+)
+
+// FitResult is the outcome of a fit along with statistics describing how good it is.
+type FitResult struct {
+	// Parameters are the best fit values of the parameters, including any fixed parameters.
+	Parameters map[string]float64
+	// ParameterNames gives the order of the parameters in Covariance, fixed parameters are not included.
+	ParameterNames []string
+	// Covariance is the covariance matrix of the parameters, estimated from the residuals unless AbsoluteSigma is set.
+	// Entries are infinite for parameters that can't be determined from the data, such as C in A*x + B + 0*C,
+	// which don't change the entries of the others, and NaN if there are no degrees of freedom.
+	Covariance [][]float64
+	// StandardErrors are the square roots of the variances of the parameters, 0 for fixed parameters.
+	StandardErrors map[string]float64
+
+	// ResidualSumOfSquares is the sum of the squares of the residuals multiplied by their weights, chi squared if the data has uncertainties.
+	ResidualSumOfSquares float64
+	// ReducedChiSquared is the residual sum of squares divided by the degrees of freedom, NaN if there are none.
+	ReducedChiSquared float64
+	// RSquared is the coefficient of determination, using the weights if the data has any.
+	RSquared         float64
+	DegreesOfFreedom int
+
+	Iterations int
+	Converged  bool
+}
+
+// solution is the parameters found by one of the minimisers.
+type solution struct {
+	params     []float64
+	iterations int
+	converged  bool
+}
+
+// newResult calculates the statistics of the fit of the model.
+func newResult(m *model, s solution, absoluteSigma bool) (*FitResult, error) {
+
+	n := len(s.params)
+
+	r := make([]float64, m.count())
+	if err := m.residuals(s.params, r); err != nil {
+		return nil, err
+	}
+	jac := newMatrix(m.count(), n)
+	if err := m.jacobian(s.params, jac); err != nil {
+		return nil, err
+	}
+
+	result := &FitResult{
+		Parameters:           map[string]float64{},
+		ParameterNames:       m.parameters,
+		StandardErrors:       map[string]float64{},
+		ResidualSumOfSquares: cost(r),
+		DegreesOfFreedom:     m.count() - n,
+		Iterations:           s.iterations,
+		Converged:            s.converged,
+	}
+
+	result.ReducedChiSquared = math.NaN()
+	if result.DegreesOfFreedom > 0 {
+		result.ReducedChiSquared = result.ResidualSumOfSquares / float64(result.DegreesOfFreedom)
+	}
+
+	mean, weights := 0.0, 0.0
+	for i, d := range m.data {
+		w := m.scales[i] * m.scales[i]
+		mean += w * d.Y
+		weights += w
+	}
+	mean /= weights
+	total := 0.0
+	for i, d := range m.data {
+		total += m.scales[i] * m.scales[i] * (d.Y - mean) * (d.Y - mean)
+	}
+	result.RSquared = 1 - result.ResidualSumOfSquares/total
+
+	scale := result.ReducedChiSquared
+	if absoluteSigma {
+		scale = 1
+	}
+
+	a, _ := normalEquations(jac, r, n)
+	result.Covariance = covariance(a, scale)
+
+	for i, name := range m.parameters {
+		result.Parameters[name] = s.params[i]
+		result.StandardErrors[name] = math.Sqrt(result.Covariance[i][i])
+	}
+	for i, name := range m.fixed {
+		result.Parameters[name] = m.fixedValue(i)
+		result.StandardErrors[name] = 0
+	}
+
+	return result, nil
+}
+
+// covariance inverts the normal matrix a of the fit to give the covariance of the parameters, multiplied by scale.
+// The parameters changed by the vectors a takes to 0 can't be determined, so their entries are infinite,
+// and the others are taken from the pseudo-inverse of a.
+func covariance(a [][]float64, scale float64) [][]float64 {
+	n := len(a)
+
+	undetermined := make([]bool, n)
+	// adding the projection onto the null space makes a invertible without changing the pseudo-inverse on the rest
+	shifted := newMatrix(n, n)
+	for i := range shifted {
+		copy(shifted[i], a[i])
+	}
+	for _, v := range orthonormalise(nullSpace(a)) {
+		for i := range v {
+			if v[i] != 0 {
+				undetermined[i] = true
+			}
+			for j := range v {
+				shifted[i][j] += v[i] * v[j]
+			}
+		}
+	}
+
+	inverse, err := invert(shifted)
+	c := newMatrix(n, n)
+	for i := range c {
+		for j := range c[i] {
+			if err != nil || undetermined[i] || undetermined[j] {
+				c[i][j] = math.Inf(1)
+			} else {
+				c[i][j] = inverse[i][j] * scale
+			}
+		}
+	}
+	return c
+}
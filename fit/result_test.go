@@ -0,0 +1,170 @@
+package fit
+
+import (
+	"math"
+	"testing"
+
+	"github.com/corwinkuiper/expression/expression"
+)
+
+func TestFitResultStatistics(t *testing.T) {
+
+	data := []DataElement{
+		{X: 0, Y: 1.1},
+		{X: 1, Y: 2.9},
+		{X: 2, Y: 5.2},
+		{X: 3, Y: 6.8},
+		{X: 4, Y: 9.1},
+		{X: 5, Y: 10.9},
+	}
+
+	expr, e := expression.GetExpression("A*x + B")
+	if e != nil {
+		t.Fatalf("Could not get expression, %s", e)
+	}
+
+	result, e := LevenbergMarquardt(data, expr, nil)
+	if e != nil {
+		t.Fatalf("Fit errored, %s", e)
+	}
+
+	// closed form of simple linear regression
+	n := float64(len(data))
+	var sumX, sumY, sumXX, sumXY float64
+	for _, d := range data {
+		sumX += d.X
+		sumY += d.Y
+		sumXX += d.X * d.X
+		sumXY += d.X * d.Y
+	}
+	sxx := sumXX - sumX*sumX/n
+	slope := (sumXY - sumX*sumY/n) / sxx
+	intercept := sumY/n - slope*sumX/n
+
+	var rss, tss float64
+	for _, d := range data {
+		residual := d.Y - (slope*d.X + intercept)
+		rss += residual * residual
+		tss += (d.Y - sumY/n) * (d.Y - sumY/n)
+	}
+	variance := rss / (n - 2)
+
+	const tolerance = 1e-9
+
+	expectParameters(t, result.Parameters, map[string]float64{
+		"A": slope,
+		"B": intercept,
+	}, tolerance)
+
+	expectParameters(t, result.StandardErrors, map[string]float64{
+		"A": math.Sqrt(variance / sxx),
+		"B": math.Sqrt(variance * sumXX / (n * sxx)),
+	}, tolerance)
+
+	if result.DegreesOfFreedom != 4 {
+		t.Errorf("Expected 4 degrees of freedom but got %d", result.DegreesOfFreedom)
+	}
+	if math.Abs(result.ResidualSumOfSquares-rss) > tolerance {
+		t.Errorf("Expected a residual sum of squares of %f but got %f", rss, result.ResidualSumOfSquares)
+	}
+	if math.Abs(result.ReducedChiSquared-variance) > tolerance {
+		t.Errorf("Expected a reduced chi squared of %f but got %f", variance, result.ReducedChiSquared)
+	}
+	if math.Abs(result.RSquared-(1-rss/tss)) > tolerance {
+		t.Errorf("Expected an R squared of %f but got %f", 1-rss/tss, result.RSquared)
+	}
+
+	if len(result.ParameterNames) != 2 || result.ParameterNames[0] != "A" || result.ParameterNames[1] != "B" {
+		t.Fatalf("Expected the parameters A and B but got %v", result.ParameterNames)
+	}
+	covariance := -variance * sumX / (n * sxx)
+	if math.Abs(result.Covariance[0][1]-covariance) > tolerance || math.Abs(result.Covariance[1][0]-covariance) > tolerance {
+		t.Errorf("Expected a covariance of %f but got %f", covariance, result.Covariance[0][1])
+	}
+
+	if !result.Converged || result.Iterations == 0 {
+		t.Errorf("Expected the fit to converge but it took %d iterations and converged is %t", result.Iterations, result.Converged)
+	}
+}
+
+func TestFitResultUndeterminedParameter(t *testing.T) {
+
+	data := []DataElement{
+		{X: 0, Y: 1},
+		{X: 1, Y: 3},
+		{X: 2, Y: 5},
+	}
+
+	// A and B can't be told apart so the covariance is infinite
+	expr, e := expression.GetExpression("(A + B)*x")
+	if e != nil {
+		t.Fatalf("Could not get expression, %s", e)
+	}
+
+	result, e := LevenbergMarquardt(data, expr, nil)
+	if e != nil {
+		t.Fatalf("Fit errored, %s", e)
+	}
+
+	if !math.IsInf(result.StandardErrors["A"], 1) {
+		t.Errorf("Expected an infinite standard error but got %f", result.StandardErrors["A"])
+	}
+}
+
+func TestFitResultPartlyUndetermined(t *testing.T) {
+
+	data := []DataElement{
+		{X: 0, Y: 1.1},
+		{X: 1, Y: 2.9},
+		{X: 2, Y: 5.2},
+		{X: 3, Y: 6.8},
+	}
+
+	// C can't be determined, which doesn't stop A and B being determined as they would be without it
+	expr, e := expression.GetExpression("A*x + B + 0*C")
+	if e != nil {
+		t.Fatalf("Could not get expression, %s", e)
+	}
+	result, e := LevenbergMarquardt(data, expr, nil)
+	if e != nil {
+		t.Fatalf("Fit errored, %s", e)
+	}
+
+	line, e := expression.GetExpression("A*x + B")
+	if e != nil {
+		t.Fatalf("Could not get expression, %s", e)
+	}
+	expected, e := LevenbergMarquardt(data, line, nil)
+	if e != nil {
+		t.Fatalf("Fit errored, %s", e)
+	}
+
+	if !math.IsInf(result.StandardErrors["C"], 1) {
+		t.Errorf("Expected an infinite standard error for C but got %f", result.StandardErrors["C"])
+	}
+	// with an extra parameter there is one fewer degree of freedom
+	correction := math.Sqrt(float64(expected.DegreesOfFreedom) / float64(result.DegreesOfFreedom))
+	for _, name := range []string{"A", "B"} {
+		want := expected.StandardErrors[name] * correction
+		if math.Abs(result.StandardErrors[name]-want) > 1e-9 {
+			t.Errorf("Expected the standard error of %s to be %f but got %f", name, want, result.StandardErrors[name])
+		}
+	}
+}
+
+func TestFitTooFewPoints(t *testing.T) {
+
+	expr, e := expression.GetExpression("A*x^2 + B*x + C")
+	if e != nil {
+		t.Fatalf("Could not get expression, %s", e)
+	}
+
+	for _, data := range [][]DataElement{nil, {{X: 0, Y: 1}, {X: 1, Y: 3}}} {
+		if _, e := LevenbergMarquardt(data, expr, nil); e == nil {
+			t.Errorf("Expected an error fitting %d points with Levenberg-Marquardt but got nothing.", len(data))
+		}
+		if _, e := LeastSquares(data, expr, nil); e == nil {
+			t.Errorf("Expected an error fitting %d points with least squares but got nothing.", len(data))
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package fit
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+const robustIterationCount = 100
+
+// Loss is the function of the residuals that a fit minimises.
+// Losses other than LinearLoss reduce the influence of outliers, and are minimised by iteratively reweighted least squares.
+type Loss int
+
+const (
+	// LinearLoss is the sum of the squared residuals, ordinary least squares.
+	LinearLoss Loss = iota
+	// HuberLoss is quadratic for small residuals and linear for residuals larger than the scale.
+	HuberLoss
+	// SoftL1Loss is a smooth approximation of the absolute value of the residuals.
+	SoftL1Loss
+	// CauchyLoss grows logarithmically for large residuals.
+	CauchyLoss
+	// TukeyLoss is Tukey's bisquare which ignores residuals larger than the scale entirely.
+	TukeyLoss
+)
+
+// tuning gives the multiple of the standard deviation of the residuals used as the scale by default.
+func (l Loss) tuning() float64 {
+	switch l {
+	case HuberLoss, SoftL1Loss:
+		return 1.345
+	case CauchyLoss:
+		return 2.385
+	case TukeyLoss:
+		return 4.685
+	}
+	return 1
+}
+
+// weight gives the weight of a residual that is u times the scale.
+func (l Loss) weight(u float64) float64 {
+	switch l {
+	case HuberLoss:
+		if math.Abs(u) <= 1 {
+			return 1
+		}
+		return 1 / math.Abs(u)
+	case SoftL1Loss:
+		return 1 / math.Sqrt(1+u*u)
+	case CauchyLoss:
+		return 1 / (1 + u*u)
+	case TukeyLoss:
+		if math.Abs(u) >= 1 {
+			return 0
+		}
+		return (1 - u*u) * (1 - u*u)
+	}
+	return 1
+}
+
+// scale gets the scale of the loss, estimating it from the median absolute deviation of the residuals if it isn't set.
+func (o *Options) scale(r []float64) float64 {
+	if o.LossScale > 0 {
+		return o.LossScale
+	}
+
+	deviations := make([]float64, len(r))
+	for i, v := range r {
+		deviations[i] = math.Abs(v)
+	}
+	sort.Float64s(deviations)
+
+	median := deviations[len(deviations)/2]
+	if len(deviations)%2 == 0 {
+		median = (deviations[len(deviations)/2-1] + median) / 2
+	}
+
+	// 1.4826 times the median absolute deviation estimates the standard deviation of normally distributed residuals
+	return o.Loss.tuning() * 1.4826 * median
+}
+
+// reweighted minimises the loss of the options using iteratively reweighted least squares.
+// Each round fits with the minimiser given and then weights every point by the loss of its residual.
+func reweighted(minimise minimiser) minimiser {
+	return func(m *model, params []float64, o *Options) (solution, error) {
+
+		r := make([]float64, m.count())
+		weights := make([]float64, m.count())
+		previous := make([]float64, len(params))
+		step := make([]float64, len(params))
+
+		iterations := 0
+
+		for round := 0; round < robustIterationCount; round++ {
+			copy(previous, params)
+
+			s, err := minimise(m, params, o)
+			if err != nil {
+				return solution{}, err
+			}
+			iterations += s.iterations
+			params = s.params
+
+			for j := range step {
+				step[j] = params[j] - previous[j]
+			}
+			if round > 0 && o.parametersConverged(step, params) {
+				return solution{params, iterations, s.converged}, nil
+			}
+
+			m.reweight(nil)
+			if err := m.residuals(params, r); err != nil {
+				return solution{}, err
+			}
+
+			scale := o.scale(r)
+			if scale == 0 {
+				// most of the points are fitted exactly
+				return solution{params, iterations, s.converged}, nil
+			}
+
+			rejected := true
+			for i, v := range r {
+				weights[i] = o.Loss.weight(v / scale)
+				rejected = rejected && weights[i] == 0
+			}
+			if rejected {
+				return solution{}, errors.New("every point was rejected as an outlier, try a larger loss scale")
+			}
+			m.reweight(weights)
+		}
+
+		return solution{params, iterations, false}, nil
+	}
+}
@@ -0,0 +1,160 @@
+package fit
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/corwinkuiper/expression/expression"
+)
+
+// outlierData is a noisy straight line y = 2x + 1 with a few wild points.
+func outlierData() []DataElement {
+	random := rand.New(rand.NewSource(1))
+
+	var data []DataElement
+	for i := 0; i < 40; i++ {
+		x := float64(i) / 4
+		data = append(data, DataElement{
+			X: x,
+			Y: 2*x + 1 + random.NormFloat64()*0.05,
+		})
+	}
+
+	data[5].Y += 30
+	data[17].Y -= 25
+	data[30].Y += 40
+	data[36].Y += 15
+
+	return data
+}
+
+func TestRobustLosses(t *testing.T) {
+
+	for _, loss := range []Loss{HuberLoss, SoftL1Loss, CauchyLoss, TukeyLoss} {
+		expr, e := expression.GetExpression("A*x + B")
+		if e != nil {
+			t.Fatalf("Could not get expression, %s", e)
+		}
+
+		result, e := LevenbergMarquardt(outlierData(), expr, &Options{
+			Loss: loss,
+		})
+		if e != nil {
+			t.Fatalf("Fit with loss %d errored, %s", loss, e)
+		}
+
+		if math.Abs(result.Parameters["A"]-2) > 0.05 || math.Abs(result.Parameters["B"]-1) > 0.1 {
+			t.Errorf("Fit with loss %d gave A = %f and B = %f, expected 2 and 1", loss, result.Parameters["A"], result.Parameters["B"])
+		}
+	}
+}
+
+func TestRobustLeastSquares(t *testing.T) {
+
+	expr, e := expression.GetExpression("A*x + B")
+	if e != nil {
+		t.Fatalf("Could not get expression, %s", e)
+	}
+
+	result, e := LeastSquares(outlierData(), expr, &Options{
+		Loss:          HuberLoss,
+		StepSize:      0.0005,
+		MaxIterations: 100000,
+	})
+	if e != nil {
+		t.Fatalf("Fit errored, %s", e)
+	}
+
+	if math.Abs(result.Parameters["A"]-2) > 0.05 || math.Abs(result.Parameters["B"]-1) > 0.1 {
+		t.Errorf("Fit gave A = %f and B = %f, expected 2 and 1", result.Parameters["A"], result.Parameters["B"])
+	}
+}
+
+func TestLinearLossAffectedByOutliers(t *testing.T) {
+
+	expr, e := expression.GetExpression("A*x + B")
+	if e != nil {
+		t.Fatalf("Could not get expression, %s", e)
+	}
+
+	result, e := LevenbergMarquardt(outlierData(), expr, nil)
+	if e != nil {
+		t.Fatalf("Fit errored, %s", e)
+	}
+
+	if math.Abs(result.Parameters["B"]-1) < 0.3 {
+		t.Fatalf("Expected the outliers to pull the ordinary fit away but got B = %f", result.Parameters["B"])
+	}
+}
+
+func TestTukeyRejectsOutliers(t *testing.T) {
+
+	expr, e := expression.GetExpression("A*x + B")
+	if e != nil {
+		t.Fatalf("Could not get expression, %s", e)
+	}
+
+	data := outlierData()
+	result, e := LevenbergMarquardt(data, expr, &Options{
+		Loss:      TukeyLoss,
+		LossScale: 1,
+	})
+	if e != nil {
+		t.Fatalf("Fit errored, %s", e)
+	}
+
+	// with the outliers weighted at zero the result matches a fit without them
+	var clean []DataElement
+	for i, d := range data {
+		if i != 5 && i != 17 && i != 30 && i != 36 {
+			clean = append(clean, d)
+		}
+	}
+
+	cleanExpr, e := expression.GetExpression("A*x + B")
+	if e != nil {
+		t.Fatalf("Could not get expression, %s", e)
+	}
+	cleanResult, e := LevenbergMarquardt(clean, cleanExpr, nil)
+	if e != nil {
+		t.Fatalf("Fit errored, %s", e)
+	}
+
+	if math.Abs(result.Parameters["A"]-cleanResult.Parameters["A"]) > 0.01 {
+		t.Errorf("Expected A to be %f but got %f", cleanResult.Parameters["A"], result.Parameters["A"])
+	}
+	if !result.Converged {
+		t.Errorf("Expected the fit to converge")
+	}
+}
+
+func TestRobustLossTooSmallScale(t *testing.T) {
+
+	expr, e := expression.GetExpression("A*x + B")
+	if e != nil {
+		t.Fatalf("Could not get expression, %s", e)
+	}
+
+	_, e = LevenbergMarquardt(outlierData(), expr, &Options{
+		Loss:      TukeyLoss,
+		LossScale: 1e-9,
+	})
+	if e == nil {
+		t.Fatal("Expected an error but got nothing.")
+	}
+}
+
+func TestRobustLossNoData(t *testing.T) {
+
+	// without parameters the fit only reweights the points
+	expr, e := expression.GetExpression("2*x")
+	if e != nil {
+		t.Fatalf("Could not get expression, %s", e)
+	}
+
+	_, e = LevenbergMarquardt(nil, expr, &Options{Loss: HuberLoss})
+	if e == nil {
+		t.Fatal("Expected an error but got nothing.")
+	}
+}
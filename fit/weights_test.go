@@ -0,0 +1,134 @@
+package fit
+
+import (
+	"math"
+	"testing"
+
+	"github.com/corwinkuiper/expression/expression"
+)
+
+func TestWeightedFitIgnoresUncertainPoint(t *testing.T) {
+
+	data := []DataElement{
+		{X: 0, Y: 1, Sigma: 0.1},
+		{X: 1, Y: 3, Sigma: 0.1},
+		{X: 2, Y: 50, Sigma: 1e6},
+		{X: 3, Y: 7, Sigma: 0.1},
+		{X: 4, Y: 9, Sigma: 0.1},
+	}
+
+	expr, e := expression.GetExpression("A*x + B")
+	if e != nil {
+		t.Fatalf("Could not get expression, %s", e)
+	}
+
+	result, e := LevenbergMarquardt(data, expr, nil)
+	if e != nil {
+		t.Fatalf("Fit errored, %s", e)
+	}
+
+	expectParameters(t, result.Parameters, map[string]float64{
+		"A": 2,
+		"B": 1,
+	}, 1e-6)
+}
+
+func TestWeightedFitAbsoluteSigma(t *testing.T) {
+
+	const sigma = 0.5
+
+	data := []DataElement{
+		{X: 0, Y: 1.1, Sigma: sigma},
+		{X: 1, Y: 2.9, Sigma: sigma},
+		{X: 2, Y: 5.2, Sigma: sigma},
+		{X: 3, Y: 6.8, Sigma: sigma},
+		{X: 4, Y: 9.1, Sigma: sigma},
+	}
+
+	expr, e := expression.GetExpression("A*x + B")
+	if e != nil {
+		t.Fatalf("Could not get expression, %s", e)
+	}
+
+	result, e := LevenbergMarquardt(data, expr, &Options{
+		AbsoluteSigma: true,
+	})
+	if e != nil {
+		t.Fatalf("Fit errored, %s", e)
+	}
+
+	// with known uncertainties the error in the slope is σ/√Sxx where Sxx = Σ(x - x̄)² = 10
+	if math.Abs(result.StandardErrors["A"]-sigma/math.Sqrt(10)) > 1e-9 {
+		t.Errorf("Expected a standard error of %f but got %f", sigma/math.Sqrt(10), result.StandardErrors["A"])
+	}
+
+	chiSquared := 0.0
+	for _, d := range data {
+		residual := d.Y - (result.Parameters["A"]*d.X + result.Parameters["B"])
+		chiSquared += residual * residual / (sigma * sigma)
+	}
+	if math.Abs(result.ResidualSumOfSquares-chiSquared) > 1e-9 {
+		t.Errorf("Expected chi squared of %f but got %f", chiSquared, result.ResidualSumOfSquares)
+	}
+
+	expr.SetVariables(map[string]float64{})
+	relative, e := LevenbergMarquardt(data, expr, nil)
+	if e != nil {
+		t.Fatalf("Fit errored, %s", e)
+	}
+
+	// without absolute sigma the errors are scaled by the reduced chi squared instead
+	expected := sigma / math.Sqrt(10) * math.Sqrt(relative.ReducedChiSquared)
+	if math.Abs(relative.StandardErrors["A"]-expected) > 1e-9 {
+		t.Errorf("Expected a standard error of %f but got %f", expected, relative.StandardErrors["A"])
+	}
+}
+
+func TestWeightFunction(t *testing.T) {
+
+	// the variance grows with x so later points should count for less
+	data := []DataElement{
+		{X: 1, Y: 2},
+		{X: 2, Y: 4},
+		{X: 3, Y: 6},
+		{X: 100, Y: 500},
+	}
+
+	expr, e := expression.GetExpression("A*x")
+	if e != nil {
+		t.Fatalf("Could not get expression, %s", e)
+	}
+
+	result, e := LevenbergMarquardt(data, expr, &Options{
+		Weight: func(d DataElement) float64 {
+			return 1 / math.Pow(d.X, 4)
+		},
+	})
+	if e != nil {
+		t.Fatalf("Fit errored, %s", e)
+	}
+
+	// minimising Σ (y - Ax)²/x⁴ gives A = Σ(y/x³) / Σ(1/x²)
+	var numerator, denominator float64
+	for _, d := range data {
+		numerator += d.Y / math.Pow(d.X, 3)
+		denominator += 1 / math.Pow(d.X, 2)
+	}
+
+	expectParameters(t, result.Parameters, map[string]float64{
+		"A": numerator / denominator,
+	}, 1e-9)
+}
+
+func TestNegativeWeight(t *testing.T) {
+
+	expr, e := expression.GetExpression("A*x")
+	if e != nil {
+		t.Fatalf("Could not get expression, %s", e)
+	}
+
+	_, e = LevenbergMarquardt([]DataElement{{X: 1, Y: 1, Sigma: -1}}, expr, nil)
+	if e == nil {
+		t.Fatal("Expected an error but got nothing.")
+	}
+}
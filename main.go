@@ -3,7 +3,6 @@ package main
 import (
 	"fmt"
 	"github.com/corwinkuiper/expression/expression"
-	"math"
 	"os"
 )
 
@@ -12,28 +11,24 @@ func main() {
 
 	expr, err := expression.GetExpression(exprStr)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		fail(err, exprStr)
 	}
 
-	expr.SetFunctions(map[string]func(float64) float64{
-		"sin":  math.Sin,
-		"cos":  math.Cos,
-		"sqrt": math.Sqrt,
-		"tan":  math.Tan,
-		"ln":   math.Log,
-	})
-
-	expr.SetVariables(map[string]float64{
-		"pi": math.Pi,
-		"e":  math.E,
-	})
+	expr.UseStandardLibrary()
 
 	result, err := expr.Eval()
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		fail(err, exprStr)
 	}
 
-	fmt.Printf("%s = %f", exprStr, result)
+	fmt.Printf("%s = %f", expr, result)
+}
+
+// fail prints the error, showing where it is in the expression if it can, and exits.
+func fail(err error, exprStr string) {
+	fmt.Println(err)
+	if syntaxError, ok := err.(expression.SyntaxError); ok && syntaxError.Snippet(exprStr) != "" {
+		fmt.Println(syntaxError.Snippet(exprStr))
+	}
+	os.Exit(1)
 }